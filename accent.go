@@ -0,0 +1,39 @@
+package main
+
+import (
+	"github.com/pkg/errors"
+)
+
+var (
+	accentAmount int // Velocity added to every trig on an accented step.
+)
+
+// accent returns a trig's velocity with the accent boost applied if its step is accented.
+func accent(step int, velocity uint8) uint8 {
+	if !bank[slot].Accents[step] {
+		return velocity
+	}
+	if v := int(velocity) + accentAmount; v < 127 {
+		return uint8(v)
+	}
+	return 127
+}
+
+// toggleAccent accents the step under a column of the visible page, or removes its accent.
+// The grid is repainted on the next cycle to show it.
+func toggleAccent(x int) {
+	step := (page * gridSize) + x
+	if step >= steps {
+		return
+	}
+	bank[slot].Accents[step] = !bank[slot].Accents[step]
+	gridPainted = false
+}
+
+// validateAccent checks the accent amount.
+func validateAccent() error {
+	if accentAmount < 0 || accentAmount > 127 {
+		return errors.Errorf("accent must be from 0 to 127, got %d", accentAmount)
+	}
+	return nil
+}
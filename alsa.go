@@ -0,0 +1,597 @@
+//go:build linux
+
+package main
+
+/*
+#cgo LDFLAGS: -lasound
+
+#include <errno.h>
+#include <stdio.h>
+#include <stdlib.h>
+#include <alsa/asoundlib.h>
+
+// ndseq_alsa_input is an event read from the sequencer.
+typedef struct {
+	int type;               // Event type, or a negative error: -EAGAIN once every event has been read.
+	int port;               // Port of ndseq's client the event was sent to.
+	unsigned int sec, nsec; // Time the event was received at, on the queue.
+	int client1, port1;     // Port that appeared, or sender of a subscription.
+	int client2, port2;     // Destination of a subscription.
+	long size;              // Number of MIDI bytes the event was decoded into.
+} ndseq_alsa_input;
+
+static int ndseq_alsa_open(snd_seq_t **seq, const char *name) {
+	int err = snd_seq_open(seq, "default", SND_SEQ_OPEN_DUPLEX, SND_SEQ_NONBLOCK);
+	if (err < 0) {
+		return err;
+	}
+	if ((err = snd_seq_set_client_name(*seq, name)) < 0) {
+		snd_seq_close(*seq);
+	}
+	return err;
+}
+
+// ndseq_alsa_create_port creates a MIDI port whose input is timestamped with the real time of a queue.
+static int ndseq_alsa_create_port(snd_seq_t *seq, const char *name, unsigned int caps, int queue) {
+	snd_seq_port_info_t *info;
+	int err = snd_seq_port_info_malloc(&info);
+	if (err < 0) {
+		return err;
+	}
+	snd_seq_port_info_set_name(info, name);
+	snd_seq_port_info_set_capability(info, caps);
+	snd_seq_port_info_set_type(info, SND_SEQ_PORT_TYPE_MIDI_GENERIC | SND_SEQ_PORT_TYPE_APPLICATION);
+	snd_seq_port_info_set_timestamping(info, 1);
+	snd_seq_port_info_set_timestamp_real(info, 1);
+	snd_seq_port_info_set_timestamp_queue(info, queue);
+	if ((err = snd_seq_create_port(seq, info)) == 0) {
+		err = snd_seq_port_info_get_port(info);
+	}
+	snd_seq_port_info_free(info);
+	return err;
+}
+
+static int ndseq_alsa_start_queue(snd_seq_t *seq, int queue) {
+	int err = snd_seq_start_queue(seq, queue, NULL);
+	if (err < 0) {
+		return err;
+	}
+	return snd_seq_drain_output(seq);
+}
+
+// ndseq_alsa_ports lists the ports of other clients that have every capability in caps.
+// It returns the number of ports, of which at most max are stored.
+static int ndseq_alsa_ports(snd_seq_t *seq, unsigned int caps, int *clients, int *ports, int max) {
+	snd_seq_client_info_t *cinfo;
+	snd_seq_port_info_t *pinfo;
+	int n = 0, self = snd_seq_client_id(seq);
+
+	if (snd_seq_client_info_malloc(&cinfo) < 0) {
+		return 0;
+	}
+	if (snd_seq_port_info_malloc(&pinfo) < 0) {
+		snd_seq_client_info_free(cinfo);
+		return 0;
+	}
+	snd_seq_client_info_set_client(cinfo, -1);
+	while (snd_seq_query_next_client(seq, cinfo) >= 0) {
+		int client = snd_seq_client_info_get_client(cinfo);
+		if (client == SND_SEQ_CLIENT_SYSTEM || client == self) {
+			continue;
+		}
+		snd_seq_port_info_set_client(pinfo, client);
+		snd_seq_port_info_set_port(pinfo, -1);
+		while (snd_seq_query_next_port(seq, pinfo) >= 0) {
+			unsigned int c = snd_seq_port_info_get_capability(pinfo);
+			if ((c & caps) != caps || (c & SND_SEQ_PORT_CAP_NO_EXPORT)) {
+				continue;
+			}
+			if (n < max) {
+				clients[n] = client;
+				ports[n] = snd_seq_port_info_get_port(pinfo);
+			}
+			n++;
+		}
+	}
+	snd_seq_port_info_free(pinfo);
+	snd_seq_client_info_free(cinfo);
+	return n;
+}
+
+// ndseq_alsa_name writes the name of a port, client:port, to buf.
+static int ndseq_alsa_name(snd_seq_t *seq, int client, int port, char *buf, size_t size) {
+	snd_seq_client_info_t *cinfo;
+	snd_seq_port_info_t *pinfo;
+	int err = snd_seq_client_info_malloc(&cinfo);
+	if (err < 0) {
+		return err;
+	}
+	if ((err = snd_seq_port_info_malloc(&pinfo)) < 0) {
+		snd_seq_client_info_free(cinfo);
+		return err;
+	}
+	if ((err = snd_seq_get_any_client_info(seq, client, cinfo)) == 0 &&
+		(err = snd_seq_get_any_port_info(seq, client, port, pinfo)) == 0) {
+		snprintf(buf, size, "%s:%s", snd_seq_client_info_get_name(cinfo), snd_seq_port_info_get_name(pinfo));
+	}
+	snd_seq_port_info_free(pinfo);
+	snd_seq_client_info_free(cinfo);
+	return err;
+}
+
+// ndseq_alsa_subscribers lists the ports connected to one of ndseq's ports, the ones it sends to if output is set.
+static int ndseq_alsa_subscribers(snd_seq_t *seq, int port, int output, int *clients, int *ports, int max) {
+	snd_seq_query_subscribe_t *q;
+	snd_seq_addr_t root;
+	int n = 0;
+
+	if (snd_seq_query_subscribe_malloc(&q) < 0) {
+		return 0;
+	}
+	root.client = snd_seq_client_id(seq);
+	root.port = port;
+	snd_seq_query_subscribe_set_root(q, &root);
+	snd_seq_query_subscribe_set_type(q, output ? SND_SEQ_QUERY_SUBS_READ : SND_SEQ_QUERY_SUBS_WRITE);
+	snd_seq_query_subscribe_set_index(q, 0);
+	while (n < max && snd_seq_query_port_subscribers(seq, q) >= 0) {
+		const snd_seq_addr_t *addr = snd_seq_query_subscribe_get_addr(q);
+		clients[n] = addr->client;
+		ports[n] = addr->port;
+		snd_seq_query_subscribe_set_index(q, ++n);
+	}
+	snd_seq_query_subscribe_free(q);
+	return n;
+}
+
+// ndseq_alsa_write schedules a MIDI message sent from a port to its subscribers at a real time on a queue.
+// It returns 0 when the bytes aren't a complete message, which drops them.
+static int ndseq_alsa_write(snd_seq_t *seq, snd_midi_event_t *enc, int port, int queue,
+	unsigned int sec, unsigned int nsec, const unsigned char *data, long size) {
+	snd_seq_event_t ev;
+	snd_seq_real_time_t t;
+
+	snd_seq_ev_clear(&ev);
+	snd_midi_event_reset_encode(enc);
+	if (snd_midi_event_encode(enc, data, size, &ev) < 0 || ev.type == SND_SEQ_EVENT_NONE) {
+		return 0;
+	}
+	t.tv_sec = sec;
+	t.tv_nsec = nsec;
+	snd_seq_ev_set_source(&ev, port);
+	snd_seq_ev_set_subs(&ev);
+	snd_seq_ev_schedule_real(&ev, queue, 0, &t);
+	return snd_seq_event_output(seq, &ev);
+}
+
+// ndseq_alsa_read reads the next event and decodes it into buf if it is a MIDI message.
+static void ndseq_alsa_read(snd_seq_t *seq, snd_midi_event_t *dec, unsigned char *buf, long size, ndseq_alsa_input *in) {
+	snd_seq_event_t *ev;
+	long n;
+	int err = snd_seq_event_input(seq, &ev);
+
+	in->size = 0;
+	if (err < 0) {
+		in->type = err;
+		return;
+	}
+	in->type = ev->type;
+	in->port = ev->dest.port;
+	in->sec = ev->time.time.tv_sec;
+	in->nsec = ev->time.time.tv_nsec;
+	switch (ev->type) {
+	case SND_SEQ_EVENT_PORT_START:
+		in->client1 = ev->data.addr.client;
+		in->port1 = ev->data.addr.port;
+		return;
+	case SND_SEQ_EVENT_PORT_SUBSCRIBED:
+		in->client1 = ev->data.connect.sender.client;
+		in->port1 = ev->data.connect.sender.port;
+		in->client2 = ev->data.connect.dest.client;
+		in->port2 = ev->data.connect.dest.port;
+		return;
+	}
+	if ((n = snd_midi_event_decode(dec, buf, size, ev)) > 0) {
+		in->size = n;
+	}
+}
+*/
+import "C"
+
+import (
+	"runtime"
+	"time"
+	"unsafe"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	alsaSupported = true
+
+	alsaRate       = 48000 // Frames per second of the ALSA backend's clock.
+	alsaPeriod     = 256   // Frames per period of the ALSA backend's clock.
+	alsaMaxPorts   = 256   // Most ports of other clients listed, or connected to a port.
+	alsaMaxEvents  = 256   // Most events an input receives in a period. Further ones are dropped.
+	alsaInputBytes = 4096  // Room for the bytes an input receives in a period.
+	alsaOutputPool = 2048  // Events the sequencer can hold on the queue for ndseq's outputs.
+	alsaNameSize   = 256   // Longest client:port name.
+)
+
+// alsaBackend runs a client of the ALSA sequencer, clocked by a timer.
+// Every period the events received are read, process is called, and the events written are
+// scheduled on a queue of the client a period later, at their frame offset, so that they keep
+// their timing whatever the timer's jitter. Input events are timestamped on the same queue.
+type alsaBackend struct {
+	seq       *C.snd_seq_t
+	queue     C.int
+	encoder   *C.snd_midi_event_t
+	decoder   *C.snd_midi_event_t
+	callbacks Callbacks
+	ports     map[C.int]*Port // The client's ports, by port number.
+
+	frame   uint64 // Frame the current period starts at on the queue.
+	stop    chan struct{}
+	stopped chan struct{}
+	scratch [alsaInputBytes]byte // Bytes of the event being read.
+}
+
+// alsaPort is the sequencer port a Port is registered as.
+type alsaPort struct {
+	port   C.int
+	output bool
+
+	// The events received in the current period and their bytes.
+	events []*MidiEvent
+	event  [alsaMaxEvents]MidiEvent
+	bytes  [alsaInputBytes]byte
+	nbytes int
+}
+
+// newALSABackend returns an ALSA sequencer backend with no client open.
+func newALSABackend() Backend {
+	return &alsaBackend{}
+}
+
+// alsaError returns the error of a negative alsa-lib result, or nil.
+func alsaError(code C.int, msg string) error {
+	if code >= 0 {
+		return nil
+	}
+	return errors.Errorf("%s: %s", msg, C.GoString(C.snd_strerror(code)))
+}
+
+func (b *alsaBackend) Open(name string, callbacks Callbacks) error {
+	cname := C.CString(name)
+	defer C.free(unsafe.Pointer(cname))
+
+	if err := alsaError(C.ndseq_alsa_open(&b.seq, cname), "opening ALSA sequencer"); err != nil {
+		b.seq = nil
+		return err
+	}
+	b.callbacks, b.ports = callbacks, map[C.int]*Port{}
+
+	if err := b.setup(cname); err != nil {
+		_ = b.Close() // Best effort.
+		return err
+	}
+	if callbacks.SampleRate != nil {
+		callbacks.SampleRate(alsaRate)
+	}
+	return nil
+}
+
+// setup makes the queue the client's events are scheduled and timestamped on, the MIDI encoder
+// and decoder, and the port the announcements of new ports and connections are received on.
+func (b *alsaBackend) setup(name *C.char) error {
+	if b.queue = C.snd_seq_alloc_named_queue(b.seq, name); b.queue < 0 {
+		return alsaError(b.queue, "allocating ALSA queue")
+	}
+	if err := alsaError(C.snd_seq_set_client_pool_output(b.seq, alsaOutputPool), "setting ALSA output pool"); err != nil {
+		return err
+	}
+	if err := alsaError(C.snd_midi_event_new(maxSysex, &b.encoder), "making MIDI encoder"); err != nil {
+		return err
+	}
+	if err := alsaError(C.snd_midi_event_new(maxSysex, &b.decoder), "making MIDI decoder"); err != nil {
+		return err
+	}
+	C.snd_midi_event_no_status(b.decoder, 1)
+
+	if b.callbacks.Registered == nil && b.callbacks.Connected == nil {
+		return nil
+	}
+	announce := C.CString("announce")
+	defer C.free(unsafe.Pointer(announce))
+
+	port := C.snd_seq_create_simple_port(b.seq, announce, C.SND_SEQ_PORT_CAP_WRITE|C.SND_SEQ_PORT_CAP_NO_EXPORT, C.SND_SEQ_PORT_TYPE_APPLICATION)
+	if port < 0 {
+		return alsaError(port, "creating announce port")
+	}
+	return alsaError(C.snd_seq_connect_from(b.seq, port, C.SND_SEQ_CLIENT_SYSTEM, C.SND_SEQ_PORT_SYSTEM_ANNOUNCE), "following ALSA announcements")
+}
+
+func (b *alsaBackend) Register(name string, p *Port, output bool) error {
+	if p.Type != "" {
+		return errors.Errorf("registering %s: the alsa backend has no %s ports", name, p.Type)
+	}
+	caps := C.uint(C.SND_SEQ_PORT_CAP_WRITE | C.SND_SEQ_PORT_CAP_SUBS_WRITE)
+	if output {
+		caps = C.SND_SEQ_PORT_CAP_READ | C.SND_SEQ_PORT_CAP_SUBS_READ
+	}
+	cname := C.CString(name)
+	defer C.free(unsafe.Pointer(cname))
+
+	port := C.ndseq_alsa_create_port(b.seq, cname, caps, b.queue)
+	if err := alsaError(port, "registering "+name); err != nil {
+		return err
+	}
+	ap := &alsaPort{port: port, output: output}
+	ap.events = make([]*MidiEvent, 0, alsaMaxEvents)
+	p.name, p.handle = name, ap
+	b.ports[port] = p
+	return nil
+}
+
+// alsaPortOf returns the sequencer port a Port is registered as.
+func alsaPortOf(p *Port) *alsaPort {
+	return p.handle.(*alsaPort)
+}
+
+func (b *alsaBackend) Start(process func(nframes uint32) int) error {
+	if err := alsaError(C.ndseq_alsa_start_queue(b.seq, b.queue), "starting ALSA queue"); err != nil {
+		return err
+	}
+	if b.callbacks.BufferSize != nil {
+		b.callbacks.BufferSize(alsaPeriod)
+	}
+	b.stop, b.stopped = make(chan struct{}), make(chan struct{})
+	go b.run(process)
+	return nil
+}
+
+// run calls process every period until the client is closed, or process fails.
+// A failure stops the clock as if the server had gone away, as JACK does with a failing client.
+func (b *alsaBackend) run(process func(nframes uint32) int) {
+	runtime.LockOSThread()
+	defer close(b.stopped)
+
+	var (
+		period = (time.Second * alsaPeriod) / alsaRate
+		start  = time.Now()
+	)
+	for n := int64(0); ; n++ {
+		select {
+		case <-b.stop:
+			return
+		default:
+		}
+		due := start.Add(time.Duration(n) * period)
+		if late := time.Since(due); late >= period {
+			skipped := int64(late / period)
+			n += skipped
+			due = due.Add(time.Duration(skipped) * period)
+			if b.callbacks.XRun != nil {
+				b.callbacks.XRun()
+			}
+		}
+		time.Sleep(time.Until(due))
+
+		b.frame = uint64(n) * alsaPeriod
+		b.read()
+		if process(alsaPeriod) != 0 {
+			if b.callbacks.Shutdown != nil {
+				b.callbacks.Shutdown()
+			}
+			return
+		}
+		C.snd_seq_drain_output(b.seq)
+	}
+}
+
+// read reads the events received since the last period. MIDI messages go to the inputs they were sent to,
+// at their offset from the start of the previous period, and announcements to the callbacks.
+func (b *alsaBackend) read() {
+	for _, p := range b.ports {
+		ap := alsaPortOf(p)
+		ap.events, ap.nbytes = ap.events[:0], 0
+	}
+	for {
+		var in C.ndseq_alsa_input
+		C.ndseq_alsa_read(b.seq, b.decoder, (*C.uchar)(unsafe.Pointer(&b.scratch[0])), alsaInputBytes, &in)
+
+		switch {
+		case in._type == -C.EAGAIN:
+			return
+		case in._type == -C.ENOSPC: // Events were lost because they weren't read in time.
+			if b.callbacks.XRun != nil {
+				b.callbacks.XRun()
+			}
+			continue
+		case in._type < 0:
+			return
+		case in._type == C.SND_SEQ_EVENT_PORT_START:
+			b.portStarted(in.client1, in.port1)
+			continue
+		case in._type == C.SND_SEQ_EVENT_PORT_SUBSCRIBED:
+			b.portSubscribed(in.client1, in.port1)
+			b.portSubscribed(in.client2, in.port2)
+			continue
+		}
+		p, ok := b.ports[C.int(in.port)]
+		if !ok || in.size == 0 {
+			continue
+		}
+		b.receive(alsaPortOf(p), uint64(in.sec), uint64(in.nsec), b.scratch[:in.size])
+	}
+}
+
+// receive adds a message received at a time on the queue to the events of an input, or drops it if there is no room left.
+func (b *alsaBackend) receive(ap *alsaPort, sec, nsec uint64, data []byte) {
+	if len(ap.events) == alsaMaxEvents || ap.nbytes+len(data) > alsaInputBytes {
+		return
+	}
+	var (
+		frame  = sec*alsaRate + (nsec*alsaRate)/uint64(time.Second)
+		offset uint32
+	)
+	if prev := b.frame - alsaPeriod; b.frame >= alsaPeriod && frame > prev {
+		offset = uint32(frame - prev)
+	}
+	if offset >= alsaPeriod {
+		offset = alsaPeriod - 1
+	}
+	buf := ap.bytes[ap.nbytes : ap.nbytes+len(data)]
+	copy(buf, data)
+	ap.nbytes += len(data)
+
+	e := &ap.event[len(ap.events)]
+	e.Time, e.Buffer = offset, buf
+	ap.events = append(ap.events, e)
+}
+
+// portStarted hands a port another client has made on to the Registered callback.
+func (b *alsaBackend) portStarted(client, port C.int) {
+	if b.callbacks.Registered == nil || client == C.snd_seq_client_id(b.seq) {
+		return
+	}
+	if name, ok := b.name(client, port); ok {
+		b.callbacks.Registered(name)
+	}
+}
+
+// portSubscribed hands one of the client's ports that was connected on to the Connected callback.
+func (b *alsaBackend) portSubscribed(client, port C.int) {
+	if b.callbacks.Connected == nil || client != C.snd_seq_client_id(b.seq) {
+		return
+	}
+	if p, ok := b.ports[port]; ok {
+		b.callbacks.Connected(p)
+	}
+}
+
+// name returns the name of a port, client:port.
+func (b *alsaBackend) name(client, port C.int) (string, bool) {
+	var buf [alsaNameSize]C.char
+	if C.ndseq_alsa_name(b.seq, client, port, &buf[0], alsaNameSize) < 0 {
+		return "", false
+	}
+	return C.GoString(&buf[0]), true
+}
+
+// names returns the names of the ports at the first n addresses.
+func (b *alsaBackend) names(clients, ports []C.int, n C.int) []string {
+	if n > alsaMaxPorts {
+		n = alsaMaxPorts
+	}
+	var names []string
+	for i := C.int(0); i < n; i++ {
+		if name, ok := b.name(clients[i], ports[i]); ok {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func (b *alsaBackend) Close() error {
+	if b.seq == nil {
+		return nil
+	}
+	if b.stop != nil {
+		close(b.stop)
+		<-b.stopped
+		b.stop = nil
+	}
+	for _, dev := range []**C.snd_midi_event_t{&b.encoder, &b.decoder} {
+		if *dev != nil {
+			C.snd_midi_event_free(*dev)
+			*dev = nil
+		}
+	}
+	err := alsaError(C.snd_seq_close(b.seq), "closing ALSA sequencer")
+	b.seq = nil
+	return err
+}
+
+func (b *alsaBackend) SampleRate() uint32 {
+	return alsaRate
+}
+
+func (b *alsaBackend) Devices(inputs bool) []string {
+	caps := C.uint(C.SND_SEQ_PORT_CAP_READ | C.SND_SEQ_PORT_CAP_SUBS_READ)
+	if inputs {
+		caps = C.SND_SEQ_PORT_CAP_WRITE | C.SND_SEQ_PORT_CAP_SUBS_WRITE
+	}
+	var clients, ports [alsaMaxPorts]C.int
+	n := C.ndseq_alsa_ports(b.seq, caps, &clients[0], &ports[0], alsaMaxPorts)
+	return b.names(clients[:], ports[:], n)
+}
+
+func (b *alsaBackend) Connect(p *Port, device string) error {
+	ap := alsaPortOf(p)
+
+	var clients, ports [alsaMaxPorts]C.int
+	n := C.ndseq_alsa_ports(b.seq, 0, &clients[0], &ports[0], alsaMaxPorts)
+	for i := C.int(0); i < n && i < alsaMaxPorts; i++ {
+		if name, ok := b.name(clients[i], ports[i]); !ok || name != device {
+			continue
+		}
+		if ap.output {
+			return alsaError(C.snd_seq_connect_to(b.seq, ap.port, clients[i], ports[i]), "connecting ALSA ports")
+		}
+		return alsaError(C.snd_seq_connect_from(b.seq, ap.port, clients[i], ports[i]), "connecting ALSA ports")
+	}
+	return errors.Errorf("no port named %s", device)
+}
+
+func (b *alsaBackend) Connections(p *Port) []string {
+	var (
+		ap             = alsaPortOf(p)
+		output         C.int
+		clients, ports [alsaMaxPorts]C.int
+	)
+	if ap.output {
+		output = 1
+	}
+	n := C.ndseq_alsa_subscribers(b.seq, ap.port, output, &clients[0], &ports[0], alsaMaxPorts)
+	return b.names(clients[:], ports[:], n)
+}
+
+// Transport reports that the transport is stopped: the ALSA sequencer has none.
+func (b *alsaBackend) Transport() (rolling bool, frame int64) {
+	return false, 0
+}
+
+func (b *alsaBackend) Timebase() error {
+	return errors.New("the alsa backend has no transport to be timebase master of")
+}
+
+func (b *alsaBackend) Publish(pos Position) {}
+
+func (b *alsaBackend) Events(p *Port, nframes uint32) []*MidiEvent {
+	return alsaPortOf(p).events
+}
+
+// Buffer returns the port itself: events are scheduled on the queue as they are written.
+func (b *alsaBackend) Buffer(p *Port, nframes uint32) MidiBuffer {
+	return MidiBuffer(unsafe.Pointer(alsaPortOf(p)))
+}
+
+// Write schedules an event a period after its frame in the current period.
+// Events the sequencer has no room for are dropped.
+func (b *alsaBackend) Write(p *Port, event *MidiEvent, buffer MidiBuffer) int {
+	if len(event.Buffer) == 0 {
+		return 0
+	}
+	var (
+		ap    = alsaPortOf(p)
+		frame = b.frame + alsaPeriod + uint64(event.Time)
+		sec   = frame / alsaRate
+		nsec  = ((frame % alsaRate) * uint64(time.Second)) / alsaRate
+	)
+	code := C.ndseq_alsa_write(b.seq, b.encoder, ap.port, b.queue, C.uint(sec), C.uint(nsec),
+		(*C.uchar)(unsafe.Pointer(&event.Buffer[0])), C.long(len(event.Buffer)))
+	if code < 0 && code != -C.EAGAIN {
+		return Failure
+	}
+	return 0
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+
+package main
+
+// alsaSupported reports whether the ALSA backend is built. The ALSA sequencer only exists on Linux.
+const alsaSupported = false
+
+// newALSABackend is never called: validateBackend refuses --backend=alsa.
+func newALSABackend() Backend {
+	return nil
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	caLife = "life" // Conway's Game of Life over the whole grid.
+)
+
+var (
+	caRule    string // Cellular automaton that evolves the playing pattern each loop. Empty disables it.
+	caSeed    int64  // Seed for the automaton's starting grid. Zero starts from the programmed pattern.
+	caLife2D  bool   // Flag telling us if caRule is the Game of Life.
+	caWolfram uint8  // Rule number of an elementary automaton.
+)
+
+// alive reports whether a cell of the grid has a trig.
+// The grid wraps around at the edges.
+func alive(g *[8][maxSteps]uint8, track, step int) bool {
+	track = (track + len(g)) % len(g)
+	step = (step + steps) % steps
+	return g[track][step] > 0
+}
+
+// evolve advances the playing pattern by one generation of the automaton.
+// Cells that are born get defaultVelocity and cells that survive keep theirs.
+func evolve() {
+	if caRule == "" {
+		return
+	}
+	prev := *trigs
+
+	for track := range trigs {
+		for step := 0; step < steps; step++ {
+			var on bool
+			if caLife2D {
+				on = lifeCell(&prev, track, step)
+			} else {
+				on = wolframCell(&prev, track, step)
+			}
+			switch {
+			case !on:
+				trigs[track][step] = 0
+			case prev[track][step] == 0:
+				trigs[track][step] = defaultVelocity
+			}
+		}
+	}
+	gridPainted = false
+}
+
+// lifeCell returns the next state of a cell under the Game of Life rules.
+func lifeCell(g *[8][maxSteps]uint8, track, step int) bool {
+	n := 0
+	for dt := -1; dt <= 1; dt++ {
+		for ds := -1; ds <= 1; ds++ {
+			if (dt != 0 || ds != 0) && alive(g, track+dt, step+ds) {
+				n++
+			}
+		}
+	}
+	return n == 3 || (n == 2 && alive(g, track, step))
+}
+
+// seedAutomaton validates the automaton flags and, if a seed was given,
+// fills the playing pattern with random cells to start from.
+func seedAutomaton() error {
+	switch caRule {
+	case "":
+		return nil
+	case caLife:
+		caLife2D = true
+	default:
+		n, err := strconv.Atoi(caRule)
+		if err != nil || n < 0 || n > 255 {
+			return errors.Errorf("automaton must be %q or a rule number from 0 to 255", caLife)
+		}
+		caWolfram = uint8(n)
+	}
+	if caSeed == 0 {
+		return nil
+	}
+	seedRand(uint32(caSeed))
+	randomizeGrid()
+	return nil
+}
+
+// randomizeGrid fills every track of the playing pattern with random trigs.
+func randomizeGrid() {
+	for track := range trigs {
+		randomizeTrack(track, 50, false)
+	}
+}
+
+// wolframCell returns the next state of a cell under an elementary automaton rule.
+// Each track evolves on its own from the cell and its neighbouring steps.
+func wolframCell(g *[8][maxSteps]uint8, track, step int) bool {
+	i := boolBit(alive(g, track, step-1))<<2 | boolBit(alive(g, track, step))<<1 | boolBit(alive(g, track, step+1))
+	return caWolfram&(1<<i) != 0
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"unsafe"
+)
+
+// MidiBuffer is the buffer of a port the events of the current period are written to.
+// Only the backend that returned it knows what it points to.
+type MidiBuffer unsafe.Pointer
+
+// MidiEvent is a MIDI message received or sent in the current period, at a frame offset from its start.
+type MidiEvent struct {
+	Time   uint32
+	Buffer []byte
+}
+
+// Backend is the way the sequencer reaches its MIDI devices and is clocked.
+// The JACK backend (see jackBackend) is clocked by the server, the ALSA one (see alsaBackend) by a timer.
+type Backend interface {
+	// Open opens a client named name. The backend tells the sequencer about changes with callbacks.
+	Open(name string, callbacks Callbacks) error
+
+	// Register registers one of the client's ports, an output or an input, under a name.
+	Register(name string, p *Port, output bool) error
+
+	// Start starts the clock, which calls process every period of nframes frames.
+	// The ports must have been registered before.
+	Start(process func(nframes uint32) int) error
+
+	// Close stops the clock and closes the client. It does nothing if the client isn't open.
+	Close() error
+
+	// SampleRate returns the number of frames per second.
+	SampleRate() uint32
+
+	// Devices returns the full names of the MIDI inputs of other clients, or of their outputs if inputs is false.
+	Devices(inputs bool) []string
+
+	// Connect connects one of the client's ports to a port of another client:
+	// an output to the other client's input, or an input to its output.
+	Connect(p *Port, device string) error
+
+	// Connections returns the full names of the ports of other clients a port is connected to.
+	Connections(p *Port) []string
+
+	// Transport reports whether the transport is rolling and the frame it is at.
+	Transport() (rolling bool, frame int64)
+
+	// Timebase makes the client the transport's timebase master, which publishes the position given to Publish.
+	Timebase() error
+
+	// Publish sets the position the timebase master publishes for the next period.
+	// It is called from the process callback.
+	Publish(pos Position)
+
+	// Events returns the events a port received in the current period.
+	Events(p *Port, nframes uint32) []*MidiEvent
+
+	// Buffer clears a port's buffer for the current period and returns it.
+	Buffer(p *Port, nframes uint32) MidiBuffer
+
+	// Write writes an event to a port's buffer. An event there is no room for is dropped.
+	Write(p *Port, event *MidiEvent, buffer MidiBuffer) int
+}
+
+// Callbacks are called by a backend when something changes outside the sequencer.
+// Nil callbacks are not called. They run outside the process callback and must not block.
+type Callbacks struct {
+	SampleRate func(rate uint32) int    // The sample rate changed.
+	BufferSize func(nframes uint32) int // The number of frames per period changed. Also called by Start.
+	XRun       func() int               // A period was missed.
+	Shutdown   func()                   // The server went away.
+	Registered func(device string)      // A port of another client appeared.
+	Connected  func(p *Port)            // One of the client's ports was connected.
+}
+
+// Position is the musical position of the start of a period, as published by the transport's timebase master.
+type Position struct {
+	Bar, Beat, Tick int     // Bar and beat count from 1, tick from 0.
+	BarStartTick    float64 // Number of ticks before the bar.
+	BeatsPerBar     float32
+	BeatType        float32 // Note value of a beat, e.g. 4 for quarter notes.
+	TicksPerBeat    float64
+	BeatsPerMinute  float64
+}
+
+// backend is the backend the sequencer runs on, set by useBackend once the flags are parsed.
+var backend Backend = sequencerBackend()
+
+// useBackend makes the sequencer run on the backend given with --backend.
+func useBackend() {
+	backend = sequencerBackend()
+}
+
+// sequencerBackend returns the backend given with --backend, with the bytes received parsed into complete
+// messages first and the MIDI monitor seeing the messages before the input filters drop any.
+func sequencerBackend() Backend {
+	return filterBackend{monitorBackend{parserBackend{newBackend()}}}
+}
+
+// newBackend returns the backend given with --backend, with no client open.
+func newBackend() Backend {
+	if backendName == backendALSA {
+		return newALSABackend()
+	}
+	return &jackBackend{}
+}
@@ -0,0 +1,159 @@
+package main
+
+const (
+	numSlots = 8 // Number of patterns in the bank, one per Launchpad top-row button.
+)
+
+// Pattern is a grid of trigs.
+type Pattern struct {
+	Trigs       [8][maxSteps]uint8     `json:"trigs"`                // Trig velocities indexed by track and step. Zero means the step is off.
+	Fill        [8][maxSteps]uint8     `json:"fill"`                 // Trig velocities played instead of Trigs while the fill button is held.
+	MinVelocity [8][maxSteps]uint8     `json:"minvelocity"`          // Lowest velocity of each trig, which plays at a random velocity up to its own. Zero means its own.
+	Probability [8][maxSteps]uint8     `json:"probability"`          // Trig probabilities in percent. Zero means 100.
+	Conditions  [8][maxSteps]Condition `json:"conditions"`           // Repetitions of the pattern that each trig fires on.
+	Ratchets    [8][maxSteps]uint8     `json:"ratchets"`             // Number of hits each trig is split into. Zero means one.
+	MicroTiming [8][maxSteps]int8      `json:"microtiming"`          // Offset of each trig in 1/24ths of a step, from -12 to 12.
+	Speed       [8]Speed               `json:"speed"`                // Playback rate of each track relative to the master step clock.
+	Triplet     [8]bool                `json:"triplet"`              // Flags telling us which tracks play three steps in the time of two.
+	Direction   [8]Direction           `json:"direction"`            // Order each track plays its steps in.
+	Gate        [8]uint8               `json:"gate"`                 // Gate of each track in percent of a hit. Zero means defaultGate.
+	Gates       [8][maxSteps]uint8     `json:"gates"`                // Gate of each trig in percent of a hit. Zero means the track's gate.
+	Notes       [8][maxSteps]uint8     `json:"notes"`                // Note each trig plays. Zero means the Nord Drum's default note.
+	Chords      [8][maxSteps]uint8     `json:"chords"`               // Rows of the note view that also play with each trig, one bit per row.
+	Pitch       [8][maxSteps]int8      `json:"pitch"`                // Semitones each step's notes are transposed by, for tuned playback.
+	Accents     [maxSteps]bool         `json:"accents"`              // Flags telling us which steps boost the velocity of every track's trig.
+	Locks       []Lock                 `json:"locks,omitempty"`      // CC values locked to individual steps.
+	Resolution  string                 `json:"resolution,omitempty"` // Note value of a step, e.g. 1/16. Empty means the --resolution flag.
+	Groove      string                 `json:"groove,omitempty"`     // Name of the groove template applied to the pattern.
+	Kit         string                 `json:"kit,omitempty"`        // Name of the kit the pattern plays. Empty means the project's.
+	Program     int                    `json:"program,omitempty"`    // Program selected when the pattern starts, from 1. Zero keeps the program.
+}
+
+var (
+	bank     [numSlots]Pattern // Patterns that can be played.
+	slot     int               // Index of the playing pattern.
+	nextSlot int               // Index of the pattern to play when the current one finishes.
+
+	topHeld [numSlots]bool // Flags telling us which top-row buttons are held down.
+	topUsed bool           // Flag telling us if a held top-row button was used as a modifier.
+)
+
+// copySlot copies the pattern in one slot to another.
+// The grid is repainted on the next cycle in case it shows the destination.
+func copySlot(src, dst int) {
+	bank[dst] = bank[src]
+	if dst == slot {
+		groove, _ = lookupGroove(bank[dst].Groove)
+		useKit()
+	}
+	gridPainted = false
+}
+
+// heldSlot returns the slot of the first held top-row button, or -1 if none is held.
+func heldSlot() int {
+	for i, held := range topHeld {
+		if held {
+			return i
+		}
+	}
+	return -1
+}
+
+// lightSlot sets the color of the top-row button for a bank slot.
+// The playing slot is lit green and a queued one flashes amber.
+func lightSlot(i int, ledBuffer MidiBuffer) int {
+	var g, r int
+
+	switch {
+	case i == slot:
+		g = 3
+	case i == nextSlot:
+		g, r = 3|flash, 3
+	}
+	return lightTops(i, g, r, ledBuffer)
+}
+
+// paintSlots lights the top-row buttons to show the playing and queued slots.
+func paintSlots(ledBuffer MidiBuffer) int {
+	for i := range bank {
+		if code := lightSlot(i, ledBuffer); isFailure(code) {
+			return code
+		}
+	}
+	return 0
+}
+
+// queueSlot schedules a pattern to start playing once the current one finishes.
+// It does nothing in song mode, where the song decides which pattern plays next.
+func queueSlot(i int, ledBuffer MidiBuffer) int {
+	if songMode || i < 0 || i >= numSlots {
+		return 0
+	}
+	prev := nextSlot
+	nextSlot = i
+
+	if code := lightSlot(prev, ledBuffer); isFailure(code) {
+		return code
+	}
+	return lightSlot(i, ledBuffer)
+}
+
+// setSlot makes a pattern the playing one and points trigs, groove and tracks at it.
+// Unknown grooves are rejected when the project is loaded, so they are ignored here.
+func setSlot(i int) {
+	slot, nextSlot, loops = i, i, 0
+	resetPlayheads()
+	trigs = &bank[i].Trigs
+	groove, _ = lookupGroove(bank[i].Groove)
+	setResolution(bank[i].Resolution)
+	useKit()
+	programDue = bank[i].Program > 0
+}
+
+// top handles presses and releases of the Launchpad top-row buttons.
+// With a side button held, pressing a top-row button selects a view.
+// With another top-row button held, it copies the held button's pattern to its slot.
+// Otherwise releasing a top-row button queues its slot,
+// and holding the playing slot's button plays the fills (see holdFill).
+func top(i int, pressed bool, ledBuffer MidiBuffer) int {
+	if i < 0 || i >= numSlots || topHeld[i] == pressed {
+		return 0
+	}
+	holdFill(i, pressed)
+
+	if pressed {
+		src := heldSlot()
+		topHeld[i] = true
+
+		switch {
+		case shifted():
+			topUsed = true
+			selectView(i)
+		case src >= 0:
+			topUsed = true
+			copySlot(src, i)
+		}
+		return 0
+	}
+	topHeld[i] = false
+
+	if topUsed {
+		if heldSlot() < 0 {
+			topUsed = false
+		}
+		return 0
+	}
+	return queueSlot(i, ledBuffer)
+}
+
+// switchSlot starts the queued pattern, if any.
+// Otherwise the playing pattern's repetition count is advanced.
+// The grid is repainted on the next cycle to show the new pattern.
+func switchSlot() {
+	if nextSlot == slot {
+		loops++
+		return
+	}
+	setSlot(nextSlot)
+	gridPainted = false
+}
@@ -0,0 +1,126 @@
+package main
+
+const (
+	rapidLEDs  = 80   // Number of LEDs the original Launchpad's rapid update sets: the pads, then the side and top-row buttons.
+	rapidNote  = 0x92 // Status byte of the rapid update messages, each of which sets the next two LEDs.
+	maxChanges = 96   // Largest number of RGB colors collected during a repaint. Later ones are sent on their own.
+	batchBytes = 512  // Size of the buffer batched LED messages are built in.
+)
+
+// ledChange is an RGB color collected during a repaint, to be sent with the others (see flushRGB).
+type ledChange struct {
+	number, r, g byte
+}
+
+// xyMode resets the original Launchpad's rapid update to the first pad, keeping the X-Y layout.
+var xyMode = []byte{0xB0, 0x00, 0x01}
+
+// rapid reports whether the Launchpad's LEDs are repainted with rapid update messages.
+func (lp *midiGrid) rapid() bool {
+	return lp.model.Layout == layout16 && lp.model.Colors == colorsRG
+}
+
+// BeginPaint starts collecting the LED changes of a repaint, on models that can set several LEDs in one message.
+// The LEDs that are not painted are turned off.
+func (lp *midiGrid) BeginPaint() {
+	lp.painting = lp.rapid() || (lp.model.Batch > 0 && !paletteLEDs)
+	lp.leds, lp.numChanges = [rapidLEDs]byte{}, 0
+}
+
+// EndPaint sends the LED changes collected since BeginPaint.
+func (lp *midiGrid) EndPaint(ledBuffer MidiBuffer) int {
+	if !lp.painting {
+		return 0
+	}
+	lp.painting = false
+	if lp.rapid() {
+		return lp.flushRapid()
+	}
+	return lp.flushRGB()
+}
+
+// collect keeps an LED change of a repaint for EndPaint, and reports whether it did.
+func (lp *midiGrid) collect(status, number byte, g, r int) bool {
+	switch {
+	case !lp.painting:
+		return false
+	case lp.rapid():
+		i := rapidIndex(status, number, lp.model.TopBase)
+		if i < 0 {
+			return false
+		}
+		lp.leds[i] = lp.ledVelocity(g&3, r)
+		if g&flash != 0 {
+			lp.leds[i] = flashVelocity(g&3, r)
+		}
+	case g&flash != 0, lp.numChanges == maxChanges:
+		return false
+	default:
+		if lp.model.Layout == layoutFire {
+			number -= firePad
+		}
+		lp.changes[lp.numChanges] = ledChange{number, lp.rgbLevel(r), lp.rgbLevel(g)}
+		lp.numChanges++
+	}
+	return true
+}
+
+// rapidIndex returns the position of an LED of the original Launchpad in the rapid update order, or -1.
+func rapidIndex(status, number, topBase byte) int {
+	if status&0xF0 == 0xB0 {
+		if i := int(number) - int(topBase); i >= 0 && i < numSlots {
+			return (gridSize * (gridSize + 1)) + i
+		}
+		return -1
+	}
+	x, y := int(number%16), int(number/16)
+	switch {
+	case y >= gridSize || x > sideColumn:
+		return -1
+	case x == sideColumn:
+		return (gridSize * gridSize) + y
+	}
+	return (gridSize * y) + x
+}
+
+// flushRapid sets every LED of the original Launchpad, two per message.
+func (lp *midiGrid) flushRapid() int {
+	if code := lp.write(xyMode); isFailure(code) {
+		return code
+	}
+	for i := 0; i < rapidLEDs; i += 2 {
+		if code := lp.write([]byte{rapidNote, lp.leds[i], lp.leds[i+1]}); isFailure(code) {
+			return code
+		}
+	}
+	return 0
+}
+
+// flushRGB sends the collected RGB colors in as few messages as the model takes.
+func (lp *midiGrid) flushRGB() int {
+	var (
+		head   = lp.model.RGB[:len(lp.model.RGB)-lp.model.Repeat]
+		repeat = lp.model.RGB[len(head):]
+	)
+	for start := 0; start < lp.numChanges; start += lp.model.Batch {
+		end := start + lp.model.Batch
+		if end > lp.numChanges {
+			end = lp.numChanges
+		}
+		n := copy(lp.batch[:], head)
+		if lp.model.Layout == layoutFire {
+			n -= 2
+			n += copy(lp.batch[n:], fireLength(end-start))
+		}
+		for _, c := range lp.changes[start:end] {
+			n += copy(lp.batch[n:], repeat)
+			n += copy(lp.batch[n:], []byte{c.number, c.r, c.g, 0})
+		}
+		lp.batch[n] = 0xF7
+
+		if code := lp.write(lp.batch[:n+1]); isFailure(code) {
+			return code
+		}
+	}
+	return 0
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+
+	"github.com/pkg/errors"
+	flag "github.com/spf13/pflag"
+)
+
+// Subcommand edits project files instead of running the sequencer.
+type Subcommand struct {
+	Usage string
+	Run   func(args []string) error
+}
+
+// subcommands are run when they are named as the first argument.
+var subcommands = map[string]Subcommand{
+	"copy": {
+		Usage: "copy FILE SRC DST\tCopy the pattern in slot SRC to slot DST.",
+		Run:   copyCommand,
+	},
+	"dump": {
+		Usage: "dump [FLAGS] FILE [REQUEST]\tStore the programs the Nord Drum sends over sysex in a .syx file, after sending it REQUEST (a sysex message in hex).",
+		Run:   dumpCommand,
+	},
+	"restore": {
+		Usage: "restore [FLAGS] FILE\tSend the programs stored in a .syx file back to the Nord Drum.",
+		Run:   restoreCommand,
+	},
+	"kits": {
+		Usage: "kits\tList the built-in kits and the channel, note and label of their tracks.",
+		Run:   kitsCommand,
+	},
+	"invert": {
+		Usage: "invert FILE SLOT [TRACK]\tTurn the trigs of the pattern in slot SLOT (or one of its tracks) off and its empty steps on.",
+		Run:   trackCommand("invert", (*Pattern).invert, nil),
+	},
+	"mirror": {
+		Usage: "mirror FILE SLOT [TRACK]\tReverse the pattern in slot SLOT (or one of its tracks) in time.",
+		Run:   trackCommand("mirror", (*Pattern).mirror, (*Pattern).mirrorAll),
+	},
+	"rotate": {
+		Usage: "rotate FILE SLOT N [TRACK]\tRotate the pattern in slot SLOT (or one of its tracks, 0-7) right by N steps, left if N is negative.",
+		Run:   rotateCommand,
+	},
+}
+
+// copyCommand copies a pattern between two slots of a project file.
+func copyCommand(args []string) error {
+	if len(args) != 3 {
+		return errors.New("usage: ndseq copy FILE SRC DST")
+	}
+	src, dst, err := parseSlots(args[1], args[2])
+	if err != nil {
+		return err
+	}
+	return editProject(args[0], func(p *Project) error {
+		p.Bank[dst] = p.Bank[src]
+		return nil
+	})
+}
+
+// rotateCommand rotates a pattern or one of its tracks in a project file.
+func rotateCommand(args []string) error {
+	if len(args) != 3 && len(args) != 4 {
+		return errors.New("usage: ndseq rotate FILE SLOT N [TRACK]")
+	}
+	i, err := parseSlot(args[1])
+	if err != nil {
+		return err
+	}
+	n, err := strconv.Atoi(args[2])
+	if err != nil {
+		return errors.New("N must be an integer")
+	}
+	tracks, err := parseTracks(args[3:])
+	if err != nil {
+		return err
+	}
+	return editProject(args[0], func(p *Project) error {
+		if len(args) == 3 {
+			p.Bank[i].rotateAll(p.length(), n)
+			return nil
+		}
+		for _, track := range tracks {
+			p.Bank[i].rotate(track, p.length(), n)
+		}
+		return nil
+	})
+}
+
+// trackCommand returns a subcommand that applies a transform to a pattern or one of its tracks in a project file.
+// If all is not nil, it transforms the whole pattern instead of each of its tracks when no track is given.
+func trackCommand(name string, transform func(p *Pattern, track, length int), all func(p *Pattern, length int)) func(args []string) error {
+	return func(args []string) error {
+		if len(args) != 2 && len(args) != 3 {
+			return errors.Errorf("usage: ndseq %s FILE SLOT [TRACK]", name)
+		}
+		i, err := parseSlot(args[1])
+		if err != nil {
+			return err
+		}
+		tracks, err := parseTracks(args[2:])
+		if err != nil {
+			return err
+		}
+		return editProject(args[0], func(p *Project) error {
+			if len(args) == 2 && all != nil {
+				all(&p.Bank[i], p.length())
+				return nil
+			}
+			for _, track := range tracks {
+				transform(&p.Bank[i], track, p.length())
+			}
+			return nil
+		})
+	}
+}
+
+// editProject reads a project file, applies an edit to it, and writes it back.
+func editProject(path string, edit func(*Project) error) error {
+	p, err := readProject(path)
+	if err != nil {
+		return err
+	}
+	if err := edit(&p); err != nil {
+		return err
+	}
+	return writeProject(path, p)
+}
+
+// parseSlot parses a bank slot number.
+func parseSlot(s string) (int, error) {
+	i, err := strconv.Atoi(s)
+	if err != nil || i < 0 || i >= numSlots {
+		return 0, errors.Errorf("slot must be between 0 and %d", numSlots-1)
+	}
+	return i, nil
+}
+
+// parseTracks parses an optional track number.
+// With no arguments it returns every track.
+func parseTracks(args []string) ([]int, error) {
+	if len(args) == 0 {
+		return []int{0, 1, 2, 3, 4, 5, 6, 7}, nil
+	}
+	track, err := strconv.Atoi(args[0])
+	if err != nil || track < 0 || track >= 8 {
+		return nil, errors.New("track must be between 0 and 7")
+	}
+	return []int{track}, nil
+}
+
+// parseSlots parses a source and destination slot number.
+func parseSlots(src, dst string) (int, int, error) {
+	s, err := parseSlot(src)
+	if err != nil {
+		return 0, 0, err
+	}
+	d, err := parseSlot(dst)
+	return s, d, err
+}
+
+// runSubcommand runs the subcommand named by the first argument, if any.
+// ok is false if the arguments don't name a subcommand.
+func runSubcommand(args []string) (ok bool, err error) {
+	if len(args) == 0 {
+		return false, nil
+	}
+	cmd, ok := subcommands[args[0]]
+	if !ok {
+		return false, nil
+	}
+	return true, errors.Wrap(cmd.Run(args[1:]), args[0])
+}
+
+// usage prints the flags and the subcommands.
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage of %s:\n", os.Args[0])
+	flag.PrintDefaults()
+	fmt.Fprintln(os.Stderr, "\nSubcommands:")
+
+	names := make([]string, 0, len(subcommands))
+	for name := range subcommands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		fmt.Fprintln(os.Stderr, "  "+subcommands[name].Usage)
+	}
+}
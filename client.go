@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const reconnectInterval = time.Second // Time between attempts to reopen the JACK client after the server went away.
+
+// Backends, the ways ndseq talks to MIDI devices.
+const (
+	backendJACK = "jack"
+	backendALSA = "alsa"
+)
+
+var (
+	backendName = backendJACK // Backend given with --backend.
+
+	// shutdown is signalled by the JACK shutdown callback.
+	shutdown = make(chan struct{}, 1)
+)
+
+// validateBackend checks the --backend flag.
+// The ALSA sequencer has no transport and no MIDI 2.0 ports, so the flags that need them are refused with it.
+func validateBackend() error {
+	switch backendName {
+	case backendJACK:
+		return nil
+	case backendALSA:
+		switch {
+		case !alsaSupported:
+			return errors.New("the alsa backend is only built on Linux")
+		case syncMode == syncTransport:
+			return errors.New("the alsa backend has no transport to sync to")
+		case timebase:
+			return errors.New("the alsa backend has no transport to be timebase master of")
+		case umpOut:
+			return errors.New("the alsa backend has no MIDI 2.0 ports to send ump tracks on")
+		}
+		return nil
+	}
+	return errors.Errorf("backend must be %q or %q, got %q", backendJACK, backendALSA, backendName)
+}
+
+// useServer checks the JACK client name and makes the JACK clients connect to the server given with --server.
+// libjack connects to the server named by JACK_DEFAULT_SERVER when the client doesn't name one.
+func useServer() error {
+	if clientName == "" || strings.Contains(clientName, ":") {
+		return errors.Errorf("client name must not be empty or contain a colon, got %q", clientName)
+	}
+	if serverName == "" {
+		return nil
+	}
+	return errors.Wrap(os.Setenv("JACK_DEFAULT_SERVER", serverName), "setting JACK server")
+}
+
+// openClient opens the backend's client, registers its ports, starts it and connects its ports.
+// The backend calls process every period.
+func openClient(process func(nframes uint32) int) error {
+	// Open the client.
+	if err := backend.Open(clientName, Callbacks{
+		SampleRate: setSamplesPerBeat,
+		BufferSize: setBufferSize,
+		XRun:       xrun,
+		Shutdown:   serverShutdown,
+		Registered: portRegistered,
+		Connected:  portConnected,
+	}); err != nil {
+		return err
+	}
+
+	// Register the ports.
+	if err := errors.Wrap(registerPorts(), "registering ports"); err != nil {
+		return err
+	}
+
+	// Start the clock.
+	if err := backend.Start(process); err != nil {
+		return err
+	}
+	if timebase {
+		if err := backend.Timebase(); err != nil {
+			return err
+		}
+	}
+
+	// Connect the devices, then restore the saved connections.
+	if err := errors.Wrap(connectPorts(), "connecting ports"); err != nil {
+		return err
+	}
+	return errors.Wrap(restoreConnections(connectionsPath), "restoring connections")
+}
+
+// setBufferSize is the buffer size callback, called when the server (e.g. PipeWire) changes the period size.
+// The process callback works from its nframes, so only bufferSize needs updating.
+func setBufferSize(n uint32) int {
+	bufferSize = n
+	return 0
+}
+
+// serverShutdown is the shutdown callback, called when the server goes away.
+func serverShutdown() {
+	select {
+	case shutdown <- struct{}{}:
+	default:
+	}
+}
+
+// reopenClient reopens the JACK client once the server is back, trying every reconnectInterval,
+// and sets the Launchpads up again. The sequencer keeps its state while the server is away.
+// It gives up when stop is closed, and reports whether the client was reopened.
+// It runs in its own goroutine so that the main loop keeps handling signals while the server is away.
+func reopenClient(stop <-chan struct{}) bool {
+	fmt.Fprintln(os.Stderr, "JACK server went away, reconnecting")
+	_ = backend.Close() // Best effort.
+
+	for {
+		select {
+		case <-stop:
+			return false
+		case <-time.After(reconnectInterval):
+		}
+		err := openClient(Process)
+		if err == nil {
+			break
+		}
+		_ = backend.Close() // Best effort.
+	}
+	runInProcess(func() {
+		for _, lp := range []*midiGrid{launchpad, launchpad2} {
+			lp.reconnect()
+		}
+	})
+	fmt.Fprintln(os.Stderr, "reconnected to the JACK server")
+	return true
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"time"
+)
+
+const (
+	clocksPerBeat = 24 // MIDI clock resolution in pulses per quarter note.
+
+	midiClock = 0xF8 // MIDI timing clock.
+	midiStart = 0xFA // MIDI start.
+	midiStop  = 0xFC // MIDI stop.
+)
+
+var (
+	clockOut     bool          // Flag telling us to send MIDI clock to the Nord Drum.
+	clockRunning bool          // Flag telling us if MIDI start has been sent.
+	clockStop    chan struct{} // Closed by the process callback once MIDI stop has been sent.
+)
+
+// clock writes the MIDI clock pulses that fall inside the current period.
+// frame is the position of the start of the period, counted from the first beat.
+// Pulses are timestamped with their offset in the period so they are sample-accurate.
+func clock(nframes uint32, frame int64) {
+	if !clockOut || samplesPerBeat == 0 {
+		return
+	}
+	if clockStop != nil {
+		queue(-1, 0, midiStop)
+		close(clockStop)
+		clockStop, clockRunning = nil, false
+		return
+	}
+	if !clockRunning {
+		queue(-1, 0, midiStart)
+		clockRunning = true
+	}
+	end := frame + int64(nframes)
+
+	for n := pulseAt(frame); pulseFrames(n) < end; n++ {
+		if t := pulseFrames(n); t >= frame {
+			queue(-1, uint32(t-frame), midiClock)
+		}
+	}
+}
+
+// stopClock sends MIDI stop and waits for the process callback to write it.
+// It gives up after a second in case the process callback is no longer running.
+func stopClock() {
+	if !clockOut {
+		return
+	}
+	done := make(chan struct{})
+	commands <- func() { clockStop = done }
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+	}
+}
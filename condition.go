@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Condition decides on which repetitions of a pattern a trig fires, Elektron style.
+// The zero Condition always fires.
+type Condition uint8
+
+// Conditions in the order they are cycled through on the grid.
+const (
+	condAlways Condition = iota
+	cond1of2
+	cond2of2
+	cond1of3
+	cond2of3
+	cond3of3
+	cond1of4
+	cond2of4
+	cond3of4
+	cond4of4
+	condFill
+	condNotFill
+	numConditions
+)
+
+var (
+	fill  bool // Flag telling us if fill mode is on.
+	loops int  // Number of times the playing pattern has repeated since it started.
+)
+
+// ratio returns the A and B of an A:B condition, or zeros for other conditions.
+func (c Condition) ratio() (a, b int) {
+	switch c {
+	case cond1of2, cond2of2:
+		return int(c-cond1of2) + 1, 2
+	case cond1of3, cond2of3, cond3of3:
+		return int(c-cond1of3) + 1, 3
+	case cond1of4, cond2of4, cond3of4, cond4of4:
+		return int(c-cond1of4) + 1, 4
+	}
+	return 0, 0
+}
+
+// fires reports whether a trig with the condition plays on the current repetition.
+func (c Condition) fires() bool {
+	switch c {
+	case condAlways:
+		return true
+	case condFill:
+		return filling()
+	case condNotFill:
+		return !filling()
+	}
+	a, b := c.ratio()
+	if b == 0 {
+		return true
+	}
+	return loops%b == a-1
+}
+
+// MarshalText encodes the condition as "", "A:B", "FILL" or "NOT-FILL".
+func (c Condition) MarshalText() ([]byte, error) {
+	return []byte(c.String()), nil
+}
+
+// String returns the text form of the condition.
+func (c Condition) String() string {
+	switch c {
+	case condAlways:
+		return ""
+	case condFill:
+		return "FILL"
+	case condNotFill:
+		return "NOT-FILL"
+	}
+	a, b := c.ratio()
+	return fmt.Sprintf("%d:%d", a, b)
+}
+
+// UnmarshalText decodes a condition encoded by MarshalText.
+func (c *Condition) UnmarshalText(text []byte) error {
+	s := strings.ToUpper(string(text))
+
+	switch s {
+	case "":
+		*c = condAlways
+		return nil
+	case "FILL":
+		*c = condFill
+		return nil
+	case "NOT-FILL":
+		*c = condNotFill
+		return nil
+	}
+	unknown := errors.Errorf("unknown trig condition %q", string(text))
+
+	parts := strings.SplitN(s, ":", 2)
+	if len(parts) != 2 {
+		return unknown
+	}
+	a, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return unknown
+	}
+	b, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return unknown
+	}
+	for cond := cond1of2; cond <= cond4of4; cond++ {
+		if ca, cb := cond.ratio(); ca == a && cb == b {
+			*c = cond
+			return nil
+		}
+	}
+	return unknown
+}
+
+// color returns the green and red brightness used to show the condition on the grid.
+func (c Condition) color() (g, r int) {
+	switch c {
+	case condAlways:
+		return 3, 0
+	case condFill:
+		return 0, 3
+	case condNotFill:
+		return 1, 3
+	}
+	return 3, 3
+}
+
+// cycleCondition moves a trig to the next condition, wrapping back to always.
+func cycleCondition(track, step int) {
+	c := &bank[slot].Conditions[track][step]
+	*c = (*c + 1) % numConditions
+}
+
+// setFill turns fill mode on or off.
+func setFill(on int) error {
+	fill = on != 0
+	return nil
+}
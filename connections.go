@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+var connectionsPath string // File the connections of ndseq's ports are restored from at startup and saved to at exit.
+
+// Connection is a connection between one of ndseq's ports and a port of another client.
+type Connection struct {
+	Port   string `json:"port"`   // Name of ndseq's port, without the client name, e.g. LaunchpadSend.
+	Device string `json:"device"` // Full name of the other port, e.g. system:midi_playback_1.
+}
+
+// currentConnections returns the connections of ndseq's ports, sorted by port name.
+func currentConnections() []Connection {
+	var conns []Connection
+	for _, ports := range []map[string]*Port{Ports.Inputs, Ports.Outputs} {
+		for name, p := range ports {
+			for _, device := range backend.Connections(p) {
+				conns = append(conns, Connection{Port: name, Device: device})
+			}
+		}
+	}
+	sort.Slice(conns, func(i, j int) bool {
+		if conns[i].Port != conns[j].Port {
+			return conns[i].Port < conns[j].Port
+		}
+		return conns[i].Device < conns[j].Device
+	})
+	return conns
+}
+
+// saveConnections writes the connections of ndseq's ports, the ones it made and the ones made by hand, to a file.
+// It does nothing if path is empty.
+func saveConnections(path string) error {
+	if path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(currentConnections(), "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "encoding connections")
+	}
+	return errors.Wrap(os.WriteFile(path, data, 0644), "writing connections file")
+}
+
+// restoreConnections makes the connections saved in a file.
+// It does nothing if path is empty or the file doesn't exist yet.
+// Connections to ports that aren't there are skipped, as the device may be plugged in later.
+func restoreConnections(path string) error {
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrap(err, "reading connections file")
+	}
+	var conns []Connection
+	if err := json.Unmarshal(data, &conns); err != nil {
+		return errors.Wrap(err, "decoding connections file")
+	}
+	for _, c := range conns {
+		if err := restoreConnection(c); err != nil {
+			fmt.Fprintf(os.Stderr, "restoring connection: %s\n", err)
+		}
+	}
+	return nil
+}
+
+// restoreConnection makes a saved connection, unless it has already been made.
+func restoreConnection(c Connection) error {
+	if out, ok := Ports.Outputs[c.Port]; ok {
+		if connected(out, c.Device) {
+			return nil
+		}
+		return connectOutput(c.Port, out, c.Device)
+	}
+	if in, ok := Ports.Inputs[c.Port]; ok {
+		if connected(in, c.Device) {
+			return nil
+		}
+		return connectInput(c.Port, in, c.Device)
+	}
+	return errors.Errorf("no port named %s", c.Port)
+}
+
+// connected reports whether one of ndseq's ports is connected to a port of another client.
+func connected(p *Port, device string) bool {
+	for _, name := range backend.Connections(p) {
+		if name == device {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	controlAddr string // Address the HTTP control API listens on. Empty disables it.
+)
+
+// boolInt returns 1 for true and 0 for false.
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// actionHandler serves an action of the sequencer, which POST or PUT runs inside the process callback.
+func actionHandler(f func()) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost && r.Method != http.MethodPut {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		runInProcess(f)
+		fmt.Fprintln(w, "ok")
+	}
+}
+
+// floatHandler serves a numeric setting of the sequencer that can have a fraction,
+// the same way as intHandler.
+func floatHandler(get func() float64, set func(float64) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			var v float64
+			runInProcess(func() { v = get() })
+			fmt.Fprintln(w, v)
+		case http.MethodPost, http.MethodPut:
+			v, err := strconv.ParseFloat(r.FormValue("value"), 64)
+			if err != nil {
+				http.Error(w, "value must be a number", http.StatusBadRequest)
+				return
+			}
+			runInProcess(func() { err = set(v) })
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			fmt.Fprintln(w, v)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// intHandler serves an integer setting of the sequencer.
+// GET returns the value and POST or PUT sets it from the "value" query parameter.
+// Both are run inside the process callback.
+func intHandler(get func() int, set func(int) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			var v int
+			runInProcess(func() { v = get() })
+			fmt.Fprintln(w, v)
+		case http.MethodPost, http.MethodPut:
+			v, err := strconv.Atoi(r.FormValue("value"))
+			if err != nil {
+				http.Error(w, "value must be an integer", http.StatusBadRequest)
+				return
+			}
+			runInProcess(func() { err = set(v) })
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			fmt.Fprintln(w, v)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// serveControl runs the HTTP control API.
+// It does nothing if no address was given.
+func serveControl() error {
+	if controlAddr == "" {
+		return nil
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/learn", actionHandler(startLearning))
+	mux.Handle("/panic", actionHandler(midiPanic))
+	mux.Handle("/fill", intHandler(func() int { return boolInt(fill) }, setFill))
+	mux.Handle("/keyboard-channel", intHandler(func() int { return keyboardChannel }, setKeyboardChannel))
+	mux.Handle("/humanize", intHandler(func() int { return humanizeDepth }, setHumanize))
+	mux.Handle("/monitor", intHandler(func() int { return boolInt(monitoring) }, setMonitor))
+	mux.Handle("/metronome", intHandler(func() int { return boolInt(metronome) }, setMetronome))
+	mux.Handle("/swing", intHandler(func() int { return swing }, setSwing))
+	mux.Handle("/tempo", floatHandler(func() float64 { return tempo }, setTempo))
+	mux.Handle("/variation", intHandler(func() int { return variation }, setVariation))
+	mux.Handle("/xruns", intHandler(xrunCount, resetXruns))
+
+	return errors.Wrap(http.ListenAndServe(controlAddr, mux), "serving control API")
+}
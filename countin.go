@@ -0,0 +1,71 @@
+package main
+
+import (
+	"github.com/pkg/errors"
+)
+
+var (
+	countInBars  int   // Number of bars counted in before recording starts.
+	countInSteps int64 // Number of steps left to count in, or 0.
+	flashing     bool  // Flag telling us if the side buttons are flashing a click.
+)
+
+// armRecording arms recording after the count-in, or disarms it.
+// Arming it again during the count-in cancels it.
+func armRecording() {
+	switch {
+	case countInSteps > 0:
+		countInSteps = 0
+	case recording || countInBars == 0:
+		toggleRecording()
+	default:
+		countInSteps = int64(countInBars*beatsPerBar) * stepsPerBeat
+	}
+}
+
+// countIn counts down the steps before recording starts.
+// It clicks and flashes the side buttons on every beat, red on the first beat of a bar and amber
+// on the others, and arms recording at the start of the last step so hits played just ahead
+// of the downbeat are recorded on it.
+func countIn(start, nframes uint32, ledBuffer MidiBuffer) int {
+	if flashing {
+		flashing = false
+		if code := paintSides(ledBuffer); isFailure(code) {
+			return code
+		}
+	}
+	if countInSteps == 0 {
+		return 0
+	}
+	left := countInSteps
+	countInSteps--
+
+	if countInSteps == 0 {
+		toggleRecording()
+	}
+	if left%stepsPerBeat != 0 {
+		return 0
+	}
+	accent := left%(beatsPerBar*stepsPerBeat) == 0
+	click(start, nframes, accent)
+	flashing = true
+
+	g := 3
+	if accent {
+		g = 0
+	}
+	for track := range muted {
+		if code := light(sideColumn, track, g, 3, ledBuffer); isFailure(code) {
+			return code
+		}
+	}
+	return 0
+}
+
+// validateCountIn checks the number of bars counted in.
+func validateCountIn() error {
+	if countInBars < 0 || countInBars > 2 {
+		return errors.Errorf("count-in must be 0, 1 or 2 bars, got %d", countInBars)
+	}
+	return nil
+}
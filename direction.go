@@ -0,0 +1,90 @@
+package main
+
+import (
+	"github.com/pkg/errors"
+)
+
+// Direction is the order a track plays its steps in.
+// The zero Direction plays forward.
+type Direction uint8
+
+// Playback directions.
+const (
+	dirForward Direction = iota
+	dirReverse
+	dirPingPong
+	dirRandom
+	numDirections
+)
+
+var directionNames = [numDirections]string{"forward", "reverse", "pingpong", "random"}
+
+// MarshalText encodes the direction as its name.
+func (d Direction) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// String returns the name of the direction.
+func (d Direction) String() string {
+	if d >= numDirections {
+		return directionNames[dirForward]
+	}
+	return directionNames[d]
+}
+
+// UnmarshalText decodes a direction from its name.
+// The empty name is forward.
+func (d *Direction) UnmarshalText(text []byte) error {
+	if len(text) == 0 {
+		*d = dirForward
+		return nil
+	}
+	for i, name := range directionNames {
+		if name == string(text) {
+			*d = Direction(i)
+			return nil
+		}
+	}
+	return errors.Errorf("unknown direction %q", string(text))
+}
+
+// step maps the number of steps a track has advanced through to the step it plays.
+// Random steps are derived from the count with a hash, so the step for a count
+// is the same whenever it is asked for. Only the steps of the loop are played.
+func (d Direction) step(track int, count uint64) int {
+	var (
+		first = loopFirst()
+		n     = uint64(loopLength())
+	)
+	switch d {
+	case dirReverse:
+		return first + int(n-1-(count%n))
+	case dirPingPong:
+		if n == 1 {
+			return first
+		}
+		p := count % (2 * (n - 1))
+		if p < n {
+			return first + int(p)
+		}
+		return first + int((2*(n-1))-p)
+	case dirRandom:
+		return first + int(mix(count^(uint64(track)<<56)^randomSeed)%n)
+	}
+	return first + int(count%n)
+}
+
+// mix is the splitmix64 finalizer, used to scramble step counts for random playback.
+func mix(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xBF58476D1CE4E5B9
+	x ^= x >> 27
+	x *= 0x94D049BB133111EB
+	x ^= x >> 31
+	return x
+}
+
+// stepAt returns the step a track plays after advancing through count steps.
+func stepAt(track int, count uint64) int {
+	return bank[slot].Direction[track].step(track, count)
+}
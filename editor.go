@@ -0,0 +1,146 @@
+package main
+
+import (
+	"github.com/pkg/errors"
+)
+
+// Param is a sound parameter of the drum module that is edited with a row of the grid.
+type Param struct {
+	Name string
+	CC   uint8
+}
+
+// EditPage is a page of up to 8 parameters, one per row of the grid.
+type EditPage struct {
+	Name   string   `yaml:"name" toml:"name"`
+	Params []string `yaml:"params" toml:"params"` // Names of the parameters' CCs in the profile, one per row.
+}
+
+var (
+	editPage int = -1 // Index of the parameter page the grid shows, or -1 for the steps.
+
+	// paramValues holds the last value sent for each CC of each track, and paramSent which of them were sent.
+	paramValues [8][128]uint8
+	paramSent   [8][128]bool
+)
+
+// editPages are the parameter pages. The defaults edit the Nord Drum 3p.
+var editPages = [][]Param{
+	{
+		{"noise-filter-freq", 14},
+		{"noise-filter-type", 15},
+		{"noise-filter-env", 16},
+		{"noise-resonance", 17},
+		{"noise-decay-type", 18},
+		{"noise-decay", 19},
+	},
+	{
+		{"tone-wave", 30},
+		{"tone-pitch", 31},
+		{"tone-bend", 32},
+		{"tone-bend-time", 33},
+		{"tone-timbre", 34},
+		{"tone-timbre-env", 35},
+		{"tone-decay", 36},
+	},
+	{
+		{"click-type", 41},
+		{"click-level", 42},
+		{"mix", 43},
+		{"level", 7},
+		{"pan", 10},
+	},
+}
+
+// editing reports whether the grid shows a parameter page.
+func editing() bool {
+	return editPage >= 0
+}
+
+// editPad handles a pad press in the last row while a top-row button is held.
+// The pad's column shows that parameter page, or the steps again if it is already shown.
+// The last pad shows the pitch page.
+func editPad(x int) {
+	switch {
+	case x == editPage:
+		editPage = -1
+	case x < len(editPages), x == pitchPage:
+		editPage = x
+	default:
+		return
+	}
+	gridPainted = false
+}
+
+// lightParam shows the value of a row's parameter for the focus track as a bar, lit up to the column of the value.
+// Parameters that have not been sent yet are not lit.
+func lightParam(y int, ledBuffer MidiBuffer) int {
+	params := editPages[editPage]
+	for x := 0; x < gridSize; x++ {
+		g, r := 0, 0
+		if y < len(params) && paramSent[focus][params[y].CC] && x <= int(paramValues[focus][params[y].CC])*(gridSize-1)/127 {
+			g, r = 3, 1
+		}
+		if code := light(x, y, g, r, ledBuffer); isFailure(code) {
+			return code
+		}
+	}
+	return 0
+}
+
+// paintParams lights the rows of the parameter page.
+func paintParams(ledBuffer MidiBuffer) int {
+	if editPage == pitchPage {
+		return paintPitch(ledBuffer)
+	}
+	for y := 0; y < gridSize; y++ {
+		if code := lightParam(y, ledBuffer); isFailure(code) {
+			return code
+		}
+	}
+	return 0
+}
+
+// resolvePages makes the parameter pages of a device profile the ones edited on the grid.
+// Parameters are named by the CCs of the profile.
+func resolvePages(pages []EditPage, ccs map[string]uint8) error {
+	if len(pages) > pitchPage {
+		return errors.Errorf("profile must have at most %d pages", pitchPage)
+	}
+	resolved := make([][]Param, len(pages))
+	for i, page := range pages {
+		if len(page.Params) > gridSize {
+			return errors.Errorf("page %s must have at most %d params", page.Name, gridSize)
+		}
+		for _, name := range page.Params {
+			cc, ok := ccs[name]
+			if !ok {
+				return errors.Errorf("page %s: unknown cc %q", page.Name, name)
+			}
+			resolved[i] = append(resolved[i], Param{Name: name, CC: cc})
+		}
+	}
+	editPages = resolved
+	return nil
+}
+
+// setParam handles a pad press on a parameter page: the row's parameter of the focus track
+// is set to the value of the pad's column, from 0 in the first column to 127 in the last.
+// On the pitch page it sets the pitch of a step instead (see setPitch).
+func setParam(x, y int, ledBuffer MidiBuffer) int {
+	if editPage == pitchPage {
+		return setPitch(x, y, ledBuffer)
+	}
+	params := editPages[editPage]
+	if y >= len(params) {
+		return 0
+	}
+	var (
+		cc    = params[y].CC
+		value = uint8((x * 127) / (gridSize - 1))
+	)
+	paramValues[focus][cc], paramSent[focus][cc] = value, true
+	queue(focus, 0, 0xB0|trackConfigs[focus].channel(), cc, value)
+
+	return lightParam(y, ledBuffer)
+}
@@ -0,0 +1,75 @@
+package main
+
+var (
+	// heldStep is the step pad held on a controller with encoders, if track is not -1.
+	// A step that was on when it was pressed is turned off when it is released,
+	// unless the encoders locked a parameter of it while it was held.
+	heldStep = struct {
+		track, step int
+		locked, off bool
+	}{track: -1}
+)
+
+// turnEncoder handles a turn of one of the controller's encoders by a number of steps.
+// An encoder changes the parameter of the row under it on the parameter page shown (the first one on other pages):
+// the lock of the held step, or the value of the focus track's parameter if no step is held.
+func turnEncoder(i, delta int, ledBuffer MidiBuffer) int {
+	p := 0
+	if editing() && editPage != pitchPage {
+		p = editPage
+	}
+	if p >= len(editPages) || i >= len(editPages[p]) {
+		return 0
+	}
+	cc := editPages[p][i].CC
+
+	if track, step := heldStep.track, heldStep.step; track >= 0 {
+		v, ok := lockValue(track, step, CC(cc))
+		if !ok {
+			v = paramValue(track, cc)
+		}
+		setLock(track, step, CC(cc), uint8(limit(int(v)+delta, 0, 127)))
+		heldStep.locked = true
+		return 0
+	}
+	v := uint8(limit(int(paramValue(focus, cc))+delta, 0, 127))
+	paramValues[focus][cc], paramSent[focus][cc] = v, true
+	queue(focus, 0, 0xB0|trackConfigs[focus].channel(), cc, v)
+
+	if editing() && p == editPage {
+		return lightParam(i, ledBuffer)
+	}
+	return 0
+}
+
+// paramValue returns the last value sent for a CC of a track, or the middle value if none was.
+func paramValue(track int, cc uint8) uint8 {
+	if !paramSent[track][cc] {
+		return 64
+	}
+	return paramValues[track][cc]
+}
+
+// pressHeldStep handles the press of a step pad on a controller with encoders.
+// Steps are turned on right away, so they can be locked while held, and off when released.
+func pressHeldStep(track, step int, velocity uint8, ledBuffer MidiBuffer) int {
+	heldStep.track, heldStep.step, heldStep.locked = track, step, false
+	heldStep.off = view == viewSteps && trigs[track][step] != 0
+	if heldStep.off {
+		return 0
+	}
+	return editStep(track, step, velocity, ledBuffer)
+}
+
+// releaseHeldStep handles the release of a pad on a controller with encoders.
+func releaseHeldStep(x, y int, ledBuffer MidiBuffer) int {
+	track, step, ok := padStep(x, y)
+	if !ok || track != heldStep.track || step != heldStep.step {
+		return 0
+	}
+	heldStep.track = -1
+	if !heldStep.off || heldStep.locked {
+		return 0
+	}
+	return editStep(track, step, 0, ledBuffer)
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"github.com/pkg/errors"
+)
+
+var (
+	faderCC int // Nord Drum CC the track faders send on their track's channel, or -1 to scale the track velocities.
+)
+
+// fader handles a move of a track's fader: it scales the velocity of the track's trigs
+// from 1% at the bottom to 100% at the top, or sends faderCC on the track's channel with --fader-cc.
+func fader(track int, value uint8) {
+	if faderCC >= 0 {
+		queue(track, 0, 0xB0|trackConfigs[track].channel(), byte(faderCC), value&0x7F)
+		return
+	}
+	v := (int(value&0x7F) * 100) / 127
+	if v < 1 {
+		v = 1
+	}
+	trackConfigs[track].Velocity = v
+}
+
+// validateFaderCC checks the CC the faders send.
+func validateFaderCC() error {
+	if faderCC < -1 || faderCC > 119 {
+		return errors.Errorf("fader cc must be from 0 to 119, got %d", faderCC)
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package main
+
+var (
+	fillHeld   bool // Flag telling us if the fill button is held.
+	fillButton = -1 // Top-row button held to play the fills, or -1.
+)
+
+// filling reports whether fill mode is on, from the control API or the fill button.
+func filling() bool {
+	return fill || fillHeld
+}
+
+// fillTrig returns the trig a track plays on a step.
+// While the fill button is held, tracks with a fill lane play it instead of their trigs.
+func fillTrig(track, step int) uint8 {
+	if fillHeld && hasFill(track) {
+		return bank[slot].Fill[track][step]
+	}
+	return generate(track, step)
+}
+
+// hasFill reports whether a track's fill lane has any trigs.
+func hasFill(track int) bool {
+	for _, trig := range bank[slot].Fill[track][:steps] {
+		if trig > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// holdFill handles presses and releases of a top-row button.
+// Holding the button of the playing slot on its own plays the fills.
+func holdFill(i int, pressed bool) {
+	switch {
+	case pressed && i == slot && fillButton < 0 && sidePress == 0 && heldSlot() < 0:
+		fillButton, fillHeld = i, true
+	case !pressed && i == fillButton:
+		fillButton, fillHeld = -1, false
+	}
+}
+
+// toggleFill turns a step of a track's fill lane on or off.
+func toggleFill(track, step int) {
+	if bank[slot].Fill[track][step] == 0 {
+		bank[slot].Fill[track][step] = defaultVelocity
+	} else {
+		bank[slot].Fill[track][step] = 0
+	}
+}
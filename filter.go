@@ -0,0 +1,158 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// filterKinds are the kinds of messages an input filter can drop, by name, with the status bytes they start with.
+// Channel messages are named by the high nibble of their status byte.
+var filterKinds = map[string][]byte{
+	"note":       {0x80, 0x90},
+	"aftertouch": {0xA0},
+	"cc":         {0xB0},
+	"program":    {0xC0},
+	"pressure":   {0xD0},
+	"bend":       {0xE0},
+	"sysex":      {0xF0, 0xF7},
+	"clock":      {0xF8},
+	"transport":  {0xFA, 0xFB, 0xFC},
+	"sensing":    {0xFE},
+}
+
+var (
+	launchpadFilter string // Filter of the messages received from the Launchpads, see parseFilter.
+	ndFilter        string // Filter of the messages received from the Nord Drum.
+)
+
+// InputFilter drops messages received on a port before the sequencer looks at them.
+type InputFilter struct {
+	drop     [256]bool // Status bytes of the messages dropped.
+	channels uint16    // Channels whose channel messages pass, one bit each from channel 1. All pass if zero.
+	low      uint8     // Lowest note of the note and aftertouch messages that pass.
+	high     uint8     // Highest note of the note and aftertouch messages that pass.
+}
+
+// parseFilter parses a comma-separated filter spec, e.g. -aftertouch,-sensing,channels=1-8,notes=36-51.
+// A -kind term drops the messages of a kind (see filterKinds), channels= lets only the channel messages
+// of a channel or range of channels through and notes= only the note and aftertouch messages of a note or range of notes.
+func parseFilter(spec string) (*InputFilter, error) {
+	f := &InputFilter{high: 127}
+	for _, term := range strings.Split(spec, ",") {
+		switch {
+		case strings.HasPrefix(term, "-"):
+			statuses, ok := filterKinds[term[1:]]
+			if !ok {
+				return nil, errors.Errorf("unknown message kind %q", term[1:])
+			}
+			for _, s := range statuses {
+				if s < 0xF0 {
+					for c := byte(0); c < 16; c++ {
+						f.drop[s|c] = true
+					}
+					continue
+				}
+				f.drop[s] = true
+			}
+		case strings.HasPrefix(term, "channels="):
+			low, high, err := parseRange(term[len("channels="):], 1, 16)
+			if err != nil {
+				return nil, errors.Wrap(err, "channels")
+			}
+			for c := low; c <= high; c++ {
+				f.channels |= 1 << uint(c-1)
+			}
+		case strings.HasPrefix(term, "notes="):
+			low, high, err := parseRange(term[len("notes="):], 0, 127)
+			if err != nil {
+				return nil, errors.Wrap(err, "notes")
+			}
+			f.low, f.high = uint8(low), uint8(high)
+		default:
+			return nil, errors.Errorf("unknown filter term %q", term)
+		}
+	}
+	return f, nil
+}
+
+// parseRange parses a number or a range of numbers like 1-8, all from min to max.
+func parseRange(s string, min, max int) (low, high int, err error) {
+	lowText, highText, ok := strings.Cut(s, "-")
+	if !ok {
+		highText = lowText
+	}
+	if low, err = strconv.Atoi(lowText); err != nil {
+		return 0, 0, errors.Errorf("%q is not a number or a range", s)
+	}
+	if high, err = strconv.Atoi(highText); err != nil {
+		return 0, 0, errors.Errorf("%q is not a number or a range", s)
+	}
+	if low < min || high > max || low > high {
+		return 0, 0, errors.Errorf("%q must be within %d-%d", s, min, max)
+	}
+	return low, high, nil
+}
+
+// passes reports whether a message gets through the filter.
+func (f *InputFilter) passes(data []byte) bool {
+	if len(data) == 0 {
+		return false
+	}
+	status := data[0]
+	if f.drop[status] {
+		return false
+	}
+	if status >= 0xF0 || status < 0x80 {
+		return true
+	}
+	if f.channels != 0 && f.channels&(1<<(status&0x0F)) == 0 {
+		return false
+	}
+	if kind := status & 0xF0; (kind == 0x80 || kind == 0x90 || kind == 0xA0) && len(data) > 1 {
+		return data[1] >= f.low && data[1] <= f.high
+	}
+	return true
+}
+
+// setFilters sets the filters of the Launchpad and Nord Drum input ports, from --launchpad-filter and --nd-filter.
+// The second Launchpad's port gets the first one's filter (see setupGrids).
+func setFilters() error {
+	for _, c := range []struct {
+		spec, port string
+	}{
+		{launchpadFilter, "LaunchpadRecv"},
+		{ndFilter, "NordDrumRecv"},
+	} {
+		if c.spec == "" {
+			continue
+		}
+		f, err := parseFilter(c.spec)
+		if err != nil {
+			return errors.Wrapf(err, "%s filter", c.port)
+		}
+		Ports.Inputs[c.port].Filter = f
+	}
+	return nil
+}
+
+// filterBackend drops the messages another backend reads from a port with a filter.
+type filterBackend struct {
+	Backend
+}
+
+func (b filterBackend) Events(p *Port, nframes uint32) []*MidiEvent {
+	events := b.Backend.Events(p, nframes)
+	if p.Filter == nil {
+		return events
+	}
+	n := 0
+	for _, e := range events {
+		if p.Filter.passes(e.Buffer) {
+			events[n] = e
+			n++
+		}
+	}
+	return events[:n]
+}
@@ -0,0 +1,87 @@
+package main
+
+const (
+	firePad     = 54 // Note of the Akai Fire's top left pad. The 4 rows of 16 pads follow from left to right.
+	fireColumns = 16 // Number of pads in a row of the Fire.
+	fireEncoder = 16 // CC of the Fire's leftmost encoder (Volume), the tempo encoder. The next two (Pan and Filter) are the swing and velocity encoders.
+)
+
+var (
+	// fireTop are the notes of the Fire buttons that take the place of the top-row buttons:
+	// Step, Note, Drum, Perform, Shift, Alt, Pattern/Song and Browser.
+	fireTop = [numSlots]byte{44, 45, 46, 47, 48, 49, 50, 33}
+
+	// fireSide are the notes of the Fire buttons that take the place of the side buttons, from the top:
+	// the 4 row mute buttons, then Pattern Up, Pattern Down, Grid Left and Grid Right.
+	fireSide = [gridSize]byte{36, 37, 38, 39, 31, 32, 34, 35}
+)
+
+// fireButtonColor returns the CC value that lights a Fire button nearest to a green and red brightness.
+// The pattern and mode buttons from Step to Pattern/Song have dull and bright red and yellow LEDs;
+// the others have a single color, on or off.
+func fireButtonColor(number byte, g, r int) byte {
+	switch {
+	case g == 0 && r == 0:
+		return 0
+	case number < fireTop[0] || number > fireTop[numSlots-2]:
+		return 2
+	case g > 0 && r > 0:
+		return 4
+	case r > 0:
+		return 3
+	}
+	return 2
+}
+
+// fireNote returns the note of the Fire pad that shows a column and row of the grid:
+// the first 4 tracks are on the left half of the Fire and the last 4 on its right half.
+func fireNote(x, y int) byte {
+	if x == sideColumn {
+		return fireSide[y]
+	}
+	return byte(firePad + (fireColumns * (y % 4)) + x + (gridSize * (y / 4)))
+}
+
+// fireXY returns the grid column and row shown by a Fire pad or button.
+func fireXY(note byte) (x, y int, ok bool) {
+	for i, n := range fireSide {
+		if n == note {
+			return sideColumn, i, true
+		}
+	}
+	i := int(note) - firePad
+	if i < 0 || i >= 4*fireColumns {
+		return 0, 0, false
+	}
+	row, col := i/fireColumns, i%fireColumns
+	return col % gridSize, row + (4 * (col / gridSize)), true
+}
+
+// fireTopSlot returns the bank slot of a Fire button taking the place of a top-row button, or -1.
+func fireTopSlot(note byte) int {
+	for i, n := range fireTop {
+		if n == note {
+			return i
+		}
+	}
+	return -1
+}
+
+// lightFire sets a Fire pad to an RGB color, or a Fire button to its nearest color, from a green and red brightness.
+func (lp *midiGrid) lightFire(number byte, g, r int) int {
+	if number < firePad {
+		return lp.write([]byte{0xB0, number, fireButtonColor(number, g, r)})
+	}
+	if lp.collect(0x90, number, g, r) {
+		return 0
+	}
+	n := copy(rgbMessage[:], lp.model.RGB)
+	n += copy(rgbMessage[n:], []byte{number - firePad, lp.rgbLevel(r), lp.rgbLevel(g), 0, 0xF7})
+
+	return lp.write(rgbMessage[:n])
+}
+
+// fireLength returns the length bytes of a Fire pad color message that sets n pads.
+func fireLength(n int) []byte {
+	return []byte{byte((4 * n) >> 7), byte((4 * n) & 0x7F)}
+}
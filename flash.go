@@ -0,0 +1,47 @@
+package main
+
+const flash = 4 // Added to a green brightness to make an LED flash between the color and off, on controllers that can.
+
+// autoFlash makes the original Launchpad flash the LEDs set to flash (see flashVelocity)
+// by switching between its two buffers on its own, so the host doesn't have to.
+var autoFlash = []byte{0xB0, 0x00, 0x28}
+
+// enableFlashing turns on the automatic flashing of the red and green models, once.
+func (lp *midiGrid) enableFlashing() int {
+	if lp.flashes || lp.model.Colors != colorsRG {
+		return 0
+	}
+	lp.flashes = true
+	return lp.write(autoFlash)
+}
+
+// flashVelocity returns the velocity that makes an LED of the red and green models flash:
+// one that only writes the buffer that isn't shown, so the color alternates with off.
+func flashVelocity(g, r int) byte {
+	return byte((16 * g) + r + 8)
+}
+
+// flashLED sets an LED to flash a color. ok is false if the model can't flash.
+// Models with a palette flash from the color set with a note or CC on channel 1 to the one set on channel 2,
+// so the LED is turned off on channel 1 first. The Push 2 blinks notes and CCs sent on channel 16.
+func (lp *midiGrid) flashLED(status, number byte, g, r int) (code int, ok bool) {
+	v := lp.ledVelocity(g, r)
+
+	switch lp.model.Colors {
+	case colorsRG:
+		return lp.write([]byte{status, number, flashVelocity(g, r)}), true
+	case colorsPalette:
+		if code := lp.write([]byte{status, number, 0}); isFailure(code) {
+			return code, true
+		}
+		return lp.write([]byte{status | 0x01, number, v}), true
+	case colorsAPC:
+		if v > 0 {
+			v++ // Blinking green, red or yellow.
+		}
+		return lp.write([]byte{status, number, v}), true
+	case colorsPush:
+		return lp.write([]byte{status | 0x0F, number, v}), true
+	}
+	return 0, false
+}
@@ -0,0 +1,43 @@
+package main
+
+const (
+	defaultGate = 50 // Gate of tracks that don't set one, in percent of a hit.
+)
+
+// gateLength returns the number of samples a hit of a step's trig sounds for,
+// out of the length samples until the next hit.
+// The step's own gate takes precedence over its track's. The note off always
+// comes at least a sample before the next hit, so that it never cuts the next note short.
+func gateLength(track, step int, length uint32) uint32 {
+	gate := uint32(bank[slot].Gates[track][step])
+	if gate == 0 {
+		gate = uint32(bank[slot].Gate[track])
+	}
+	if gate == 0 {
+		gate = defaultGate
+	}
+	n := (length * gate) / 100
+	if n >= length {
+		n = length - 1
+	}
+	if n < 1 {
+		return 1
+	}
+	return n
+}
+
+// noteOff reports whether a message is a note off, including a note on with velocity 0.
+func noteOff(data []byte) bool {
+	if len(data) < 3 {
+		return false
+	}
+	return data[0]&0xF0 == 0x80 || (data[0]&0xF0 == 0x90 && data[2] == 0)
+}
+
+// setGate sets the gate of a track in percent of a hit.
+func setGate(track int, gate int) {
+	if gate < 1 || gate > 100 {
+		return
+	}
+	bank[slot].Gate[track] = uint8(gate)
+}
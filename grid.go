@@ -0,0 +1,310 @@
+package main
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// GridController is a pad controller the sequencer is played from: a grid of gridSize by gridSize pads
+// with a column of side buttons, one per track, and a row of top buttons, one per bank slot.
+// Controllers turn what is done on them into GridEvents and show the LED colors the sequencer sets.
+// Colors are a green and red brightness, from 0 (off) to 3 (full), as on the original Launchpad.
+// ledBuffer is the cycle's buffer of the LaunchpadSend port; controllers on other ports write to their own.
+type GridController interface {
+	// Start is called at the start of every cycle, before the grid is painted, to set the controller up.
+	Start(ledBuffer MidiBuffer) int
+
+	// Stop is called once, in the cycle after stopGrid is, to put the controller back as it was.
+	Stop(ledBuffer MidiBuffer) int
+
+	// Events appends the events received since the last cycle to events and returns it.
+	// It may handle messages that aren't events itself.
+	Events(nframes uint32, events []GridEvent) []GridEvent
+
+	// Light sets the LED of the pad at column x and row y, or of side button y at column sideColumn.
+	Light(x, y, g, r int, ledBuffer MidiBuffer) int
+
+	// LightTop sets the LED of top button i.
+	LightTop(i, g, r int, ledBuffer MidiBuffer) int
+
+	// Encoders returns the number of encoders that lock parameters of held steps (see turnEncoder).
+	Encoders() int
+
+	// BeginPaint is called before the whole grid is painted and EndPaint after it,
+	// so that the controller can send the LEDs together.
+	BeginPaint()
+	EndPaint(ledBuffer MidiBuffer) int
+}
+
+// GridEventKind is what was done on a grid controller.
+type GridEventKind int
+
+// Grid event kinds.
+const (
+	GridPad      GridEventKind = iota // Pad X, Y pressed or released, with a velocity (zero for the default).
+	GridSide                          // Side button Y pressed or released.
+	GridTop                           // Top button X pressed or released.
+	GridPressure                      // Pad X, Y held with a pressure.
+	GridFader                         // Fader of track X moved to a value from 0 to 127.
+	GridEncoder                       // Encoder X turned by a number of steps, negative counterclockwise.
+	GridTempo                         // Tempo encoder turned by a number of steps.
+	GridSwing                         // Swing encoder turned by a number of steps.
+	GridVelocity                      // Velocity encoder turned by a number of steps.
+	GridPage                          // Page buttons pressed to move the visible page by a number of pages.
+)
+
+// GridEvent is something done on a grid controller.
+type GridEvent struct {
+	Kind    GridEventKind
+	X, Y    int
+	Pressed bool
+	Value   int // Velocity, pressure, fader value, encoder steps or pages.
+}
+
+const (
+	maxGridEvents    = 256 // Largest number of grid events handled in a cycle.
+	maxVelocityScale = 200 // Largest velocity percentage the velocity encoder sets.
+)
+
+// Roles of the second controller.
+const (
+	roleSpan    = "span"    // It shows the page after the first controller's.
+	rolePerform = "perform" // Its pads are the performance controls (see performPad).
+)
+
+var (
+	grid  GridController   = launchpad // Controller the sequencer is played from.
+	grids []GridController             // grid, then the second controller if there is one.
+
+	launchpad2     = &midiGrid{model: &launchpads[0]} // Second Launchpad, on the Launchpad2Recv and Launchpad2Send ports.
+	launchpad2Name string                             // Model of the second Launchpad, "auto" to detect it, or empty for none.
+	launchpad2Role string                             // What the second Launchpad is for: roleSpan or rolePerform.
+
+	activeGrid = -1 // Index in grids of the controller whose events are handled or which is painted, or -1.
+
+	gridEvents [maxGridEvents]GridEvent // Buffer the events of a cycle are read into, so reading them doesn't allocate.
+	gridStop   chan struct{}            // Closed by the process callback once the controllers have been stopped.
+	gridDone   bool                     // Flag telling us if the controllers have been stopped, after which their LEDs are left alone.
+)
+
+// setupGrids sets up the controllers the sequencer is played from,
+// adding the ports of the second Launchpad if one is given.
+func setupGrids() error {
+	grids = []GridController{grid}
+	if launchpad2Name == "" {
+		return nil
+	}
+	if launchpad2Role != roleSpan && launchpad2Role != rolePerform {
+		return errors.Errorf("launchpad2 role must be %s or %s, got %q", roleSpan, rolePerform, launchpad2Role)
+	}
+	if err := launchpad2.setModel(launchpad2Name); err != nil {
+		return err
+	}
+	grids = append(grids, launchpad2)
+
+	// Both Launchpads match the same device ports, so each is connected to a different one.
+	Ports.Inputs["LaunchpadRecv"].Only = 1
+	Ports.Outputs["LaunchpadSend"].Only = 1
+	Ports.Inputs["Launchpad2Recv"] = &Port{Matches: Ports.Inputs["LaunchpadRecv"].Matches, Only: 2, Filter: Ports.Inputs["LaunchpadRecv"].Filter}
+	Ports.Outputs["Launchpad2Send"] = &Port{Matches: Ports.Outputs["LaunchpadSend"].Matches, Only: 2}
+	return nil
+}
+
+// clearGridBuffers gets the buffers of the Launchpad ports for the current period
+// and returns the LaunchpadSend port's.
+func clearGridBuffers(nframes uint32) MidiBuffer {
+	launchpad.buffer = backend.Buffer(launchpadOutput, nframes)
+	if launchpad2.out != nil {
+		launchpad2.buffer = backend.Buffer(launchpad2.out, nframes)
+	}
+	return launchpad.buffer
+}
+
+// currentGrid returns the controller whose events are handled or which is painted, or the first one.
+func currentGrid() GridController {
+	if activeGrid < 0 {
+		return grid
+	}
+	return grids[activeGrid]
+}
+
+// showsSteps reports whether a controller shows steps: every controller but a performance one.
+func showsSteps(i int) bool {
+	return i == 0 || launchpad2Role == roleSpan
+}
+
+// performing reports whether the controller whose events are handled or which is painted is a performance one.
+func performing() bool {
+	return activeGrid > 0 && launchpad2Role == rolePerform
+}
+
+// gridPage returns the number of pages after page that a controller shows.
+func gridPage(i int) int {
+	if i <= 0 || launchpad2Role != roleSpan {
+		return 0
+	}
+	return i
+}
+
+// withGrid runs f with controller i as the one whose events are handled or which is painted,
+// and page moved to the page it shows.
+func withGrid(i int, f func() int) int {
+	prev := activeGrid
+	offset := gridPage(i) - gridPage(prev)
+
+	activeGrid, page = i, page+offset
+	code := f()
+	activeGrid, page = prev, page-offset
+
+	return code
+}
+
+// eachStepGrid runs f with each controller that shows steps (see withGrid).
+func eachStepGrid(f func() int) int {
+	for i := range grids {
+		if !showsSteps(i) {
+			continue
+		}
+		if code := withGrid(i, f); isFailure(code) {
+			return code
+		}
+	}
+	return 0
+}
+
+// lightGrids sets an LED at column x and row y: side buttons on every controller, and pads on the
+// controller whose events are handled or which is painted, or else on every controller that shows steps.
+func lightGrids(x, y, g, r int, ledBuffer MidiBuffer) int {
+	if gridDone {
+		return 0
+	}
+	if x != sideColumn && activeGrid >= 0 {
+		return grids[activeGrid].Light(x, y, g, r, ledBuffer)
+	}
+	for i, c := range grids {
+		if x != sideColumn && !showsSteps(i) {
+			continue
+		}
+		if code := c.Light(x, y, g, r, ledBuffer); isFailure(code) {
+			return code
+		}
+	}
+	return 0
+}
+
+// lightTops sets the LED of top button i on every controller.
+func lightTops(i, g, r int, ledBuffer MidiBuffer) int {
+	if gridDone {
+		return 0
+	}
+	for _, c := range grids {
+		if code := c.LightTop(i, g, r, ledBuffer); isFailure(code) {
+			return code
+		}
+	}
+	return 0
+}
+
+// startGrids sets the controllers up at the start of a cycle, and stops them once stopGrid asks for it.
+func startGrids(ledBuffer MidiBuffer) int {
+	if gridDone {
+		return 0
+	}
+	for _, c := range grids {
+		if code := c.Start(ledBuffer); isFailure(code) {
+			return code
+		}
+	}
+	if gridStop == nil {
+		return 0
+	}
+	defer func() {
+		close(gridStop)
+		gridStop, gridDone = nil, true
+	}()
+	for _, c := range grids {
+		if code := c.Stop(ledBuffer); isFailure(code) {
+			return code
+		}
+	}
+	return 0
+}
+
+// gridInput handles the events of the controllers since the last cycle.
+func gridInput(nframes uint32, ledBuffer MidiBuffer) int {
+	for i, c := range grids {
+		code := withGrid(i, func() int {
+			for _, e := range c.Events(nframes, gridEvents[:0]) {
+				if code := gridEvent(e, ledBuffer); isFailure(code) {
+					return code
+				}
+			}
+			return 0
+		})
+		if isFailure(code) {
+			return code
+		}
+	}
+	return 0
+}
+
+// gridEvent handles an event of the controller whose events are handled.
+func gridEvent(e GridEvent, ledBuffer MidiBuffer) int {
+	switch e.Kind {
+	case GridPad:
+		if performing() {
+			return performPad(e.X, e.Y, e.Pressed)
+		}
+		velocity := uint8(e.Value)
+		if velocity == 0 {
+			velocity = defaultVelocity
+		}
+		return pad(e.X, e.Y, e.Pressed, velocity, ledBuffer)
+	case GridSide:
+		return side(e.Y, e.Pressed, ledBuffer)
+	case GridTop:
+		return top(e.X, e.Pressed, ledBuffer)
+	case GridPressure:
+		return holdStep(e.X, e.Y, uint8(e.Value), ledBuffer)
+	case GridFader:
+		fader(e.X, uint8(e.Value))
+	case GridEncoder:
+		return turnEncoder(e.X, e.Value, ledBuffer)
+	case GridTempo:
+		changeTempo(float64(e.Value) * tempoFine)
+	case GridSwing:
+		_ = setSwing(limit(swing+e.Value, 0, 100))
+	case GridVelocity:
+		v := trackConfigs[focus].Velocity
+		if v == 0 {
+			v = 100
+		}
+		trackConfigs[focus].Velocity = limit(v+e.Value, 1, maxVelocityScale)
+	case GridPage:
+		turnPage(e.Value)
+	}
+	return 0
+}
+
+// stopGrid turns the controllers' LEDs off and puts them back as they were before ndseq started.
+func stopGrid() {
+	done := make(chan struct{})
+	commands <- func() { gridStop = done }
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+	}
+}
+
+// limit limits a number to a range.
+func limit(v, lo, hi int) int {
+	if v < lo {
+		return lo
+	}
+	if v > hi {
+		return hi
+	}
+	return v
+}
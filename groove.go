@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Groove is a timing and velocity template applied to the steps of a pattern.
+// Both lists repeat over the pattern, so a groove can be shorter than the pattern.
+type Groove struct {
+	Timing   []float64 `json:"timing"`   // Offset of each step as a fraction of a step, from -0.5 to 0.5.
+	Velocity []int     `json:"velocity"` // Amount added to the velocity of each step's trigs.
+}
+
+var (
+	grooveDir string             // Directory that groove templates are loaded from.
+	grooves   map[string]*Groove // Groove templates indexed by name.
+	groove    *Groove            // Groove of the playing pattern. Nil means no groove.
+)
+
+// delay returns the number of samples a step is offset by.
+func (g *Groove) delay(step int) int64 {
+	if g == nil || len(g.Timing) == 0 {
+		return 0
+	}
+	return int64(g.Timing[step%len(g.Timing)] * float64(samplesPerStep()))
+}
+
+// velocity returns a trig's velocity with the groove's offset for a step applied.
+func (g *Groove) velocity(step int, trig uint8) uint8 {
+	if g == nil || len(g.Velocity) == 0 || trig == 0 {
+		return trig
+	}
+	v := int(trig) + g.Velocity[step%len(g.Velocity)]
+
+	switch {
+	case v < 1:
+		return 1
+	case v > 127:
+		return 127
+	}
+	return uint8(v)
+}
+
+// validate checks that the groove's timing offsets stay within half a step.
+func (g *Groove) validate() error {
+	for i, t := range g.Timing {
+		if t < -0.5 || t > 0.5 {
+			return errors.Errorf("timing offset %d must be between -0.5 and 0.5", i)
+		}
+	}
+	return nil
+}
+
+// loadGrooves reads every .json file in a directory as a groove template.
+// Grooves are named after their file without the extension.
+// It does nothing if dir is empty.
+func loadGrooves(dir string) error {
+	if dir == "" {
+		return nil
+	}
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return errors.Wrap(err, "listing grooves")
+	}
+	grooves = make(map[string]*Groove, len(paths))
+
+	for _, path := range paths {
+		g, err := readGroove(path)
+		if err != nil {
+			return errors.Wrap(err, path)
+		}
+		grooves[strings.TrimSuffix(filepath.Base(path), ".json")] = g
+	}
+	return nil
+}
+
+// lookupGroove returns the groove with the given name.
+// The empty name returns a nil groove, which leaves playback unchanged.
+func lookupGroove(name string) (*Groove, error) {
+	if name == "" {
+		return nil, nil
+	}
+	g, ok := grooves[name]
+	if !ok {
+		return nil, errors.Errorf("unknown groove %q", name)
+	}
+	return g, nil
+}
+
+// readGroove reads a groove template from a file.
+func readGroove(path string) (*Groove, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "opening groove file")
+	}
+	defer func() { _ = f.Close() }() // Best effort.
+
+	g := &Groove{}
+	if err := json.NewDecoder(f).Decode(g); err != nil {
+		return nil, errors.Wrap(err, "decoding groove file")
+	}
+	return g, g.validate()
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// registered hands the ports registered after ndseq has started to connectRegistered.
+var registered = make(chan string, 64)
+
+// portRegistered is the backend's callback for ports of other clients that appear.
+// New ports are connected by connectRegistered, as backend callbacks must not connect ports themselves.
+func portRegistered(device string) {
+	select {
+	case registered <- device:
+	default: // Backend callbacks must not block.
+	}
+}
+
+// connectRegistered connects the outputs and inputs to the MIDI ports of other clients that appear
+// after ndseq has started, e.g. when a Launchpad or the Scarlett is plugged in.
+func connectRegistered() {
+	for name := range registered {
+		var err error
+		switch {
+		case isDevicePort(name, true):
+			err = connectNew(Ports.Outputs, name, connectOutput)
+		case isDevicePort(name, false):
+			err = connectNew(Ports.Inputs, name, connectInput)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "connecting new port: %s\n", err)
+		}
+	}
+}
+
+// isDevicePort reports whether a port is a MIDI input of another client, or a MIDI output if inputs is false.
+func isDevicePort(name string, inputs bool) bool {
+	for _, device := range backend.Devices(inputs) {
+		if device == name {
+			return true
+		}
+	}
+	return false
+}
+
+// connectNew connects the outputs or inputs that match a new port to it.
+// Of the ports that only connect to one of the ports they match, the new port goes to
+// the first one that isn't connected (see unconnected).
+func connectNew(ports map[string]*Port, device string, connect func(name string, own *Port, device string) error) error {
+	var taken bool
+
+	for name, p := range ports {
+		if !p.Matches(device) || (p.Only > 0 && (taken || !unconnected(ports, p, device))) {
+			continue
+		}
+		if err := connect(name, p, device); err != nil {
+			return err
+		}
+		taken = taken || p.Only > 0
+	}
+	return nil
+}
+
+// unconnected reports whether a port that only connects to one of the ports it matches
+// should take a new port: it isn't connected, and no port before it that matches the new one is free.
+func unconnected(ports map[string]*Port, p *Port, device string) bool {
+	if len(backend.Connections(p)) > 0 {
+		return false
+	}
+	for _, o := range ports {
+		if o.Only > 0 && o.Only < p.Only && o.Matches(device) && len(backend.Connections(o)) == 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"github.com/pkg/errors"
+)
+
+// Humanize says how far a track's hits randomly stray from the pattern.
+type Humanize struct {
+	Velocity int `json:"velocity"` // Largest amount added to or taken from the velocity of a hit.
+	Timing   int `json:"timing"`   // Largest number of milliseconds a hit is played early or late.
+}
+
+var (
+	humanizeDepth int // Percentage the humanize settings of every track are scaled by.
+)
+
+// deviation returns a random amount from -max to max, scaled by the humanize depth.
+func deviation(max int) int {
+	if max <= 0 || humanizeDepth <= 0 {
+		return 0
+	}
+	return ((int(rand()%uint32((2*max)+1)) - max) * humanizeDepth) / 100
+}
+
+// humanizeOffset returns a hit's offset from the start of the current period moved randomly by the track's timing setting.
+// Hits are not moved before the start of the period, so early hits need --lookahead to stray early.
+func humanizeOffset(track int, offset uint32) uint32 {
+	d := (int64(deviation(trackConfigs[track].Humanize.Timing)) * int64(sampleRate)) / 1000
+
+	if d < -int64(offset) {
+		return 0
+	}
+	return uint32(int64(offset) + d)
+}
+
+// humanizeVelocity returns a hit's velocity changed randomly by the track's velocity setting, limited to 1-127.
+func humanizeVelocity(track int, velocity uint8) uint8 {
+	v := int(velocity) + deviation(trackConfigs[track].Humanize.Velocity)
+
+	switch {
+	case v < 1:
+		return 1
+	case v > 127:
+		return 127
+	}
+	return uint8(v)
+}
+
+// setHumanize sets the percentage the humanize settings are scaled by.
+func setHumanize(depth int) error {
+	if depth < 0 || depth > 100 {
+		return errors.Errorf("humanize must be from 0 to 100, got %d", depth)
+	}
+	humanizeDepth = depth
+	return nil
+}
+
+// validate checks that the humanize settings are not negative and keep velocities in range.
+func (h Humanize) validate() error {
+	if h.Velocity < 0 || h.Velocity > 127 {
+		return errors.New("humanize velocity must be between 0 and 127")
+	}
+	if h.Timing < 0 {
+		return errors.New("humanize timing must not be negative")
+	}
+	return nil
+}
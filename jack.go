@@ -0,0 +1,210 @@
+package main
+
+import (
+	"unsafe"
+
+	"github.com/pkg/errors"
+	"github.com/xthexder/go-jack"
+)
+
+// jackBackend runs a client of the JACK server, clocked by the JACK process callback.
+type jackBackend struct {
+	client    *jack.Client
+	callbacks Callbacks
+	ports     map[string]*Port // The client's ports, by full name.
+}
+
+// jackPort is the JACK port a Port is registered as.
+type jackPort struct {
+	*jack.Port
+
+	output bool
+	events []*MidiEvent // The events returned by Events, reused every period.
+}
+
+// jackPortOf returns the JACK port a Port is registered as.
+func jackPortOf(p *Port) *jackPort {
+	return p.handle.(*jackPort)
+}
+
+func (b *jackBackend) Open(name string, callbacks Callbacks) error {
+	var code int
+
+	b.client, code = jack.ClientOpen(name, jack.NoStartServer)
+	if err := wrapCode(code, "opening JACK client"); err != nil {
+		return err
+	}
+	b.callbacks, b.ports = callbacks, map[string]*Port{}
+
+	if callbacks.Shutdown != nil {
+		b.client.OnShutdown(callbacks.Shutdown)
+	}
+	if callbacks.SampleRate != nil {
+		if err := wrapCode(b.client.SetSampleRateCallback(callbacks.SampleRate), "setting sample rate callback"); err != nil {
+			return err
+		}
+	}
+	if callbacks.BufferSize != nil {
+		if err := wrapCode(b.client.SetBufferSizeCallback(callbacks.BufferSize), "setting buffer size callback"); err != nil {
+			return err
+		}
+	}
+	if callbacks.XRun != nil {
+		if err := wrapCode(b.client.SetXRunCallback(callbacks.XRun), "setting xrun callback"); err != nil {
+			return err
+		}
+	}
+	if callbacks.Connected != nil {
+		if err := wrapCode(b.client.SetPortConnectCallback(b.portConnected), "setting port connect callback"); err != nil {
+			return err
+		}
+	}
+	if callbacks.Registered != nil {
+		if err := wrapCode(b.client.SetPortRegistrationCallback(b.portRegistered), "setting port registration callback"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// portConnected is the JACK port connect callback. It hands the client's ports that were connected on.
+func (b *jackBackend) portConnected(a, c jack.PortId, connected bool) {
+	if !connected {
+		return
+	}
+	for _, id := range []jack.PortId{a, c} {
+		if jp := b.client.GetPortById(id); jp != nil {
+			if p, ok := b.ports[jp.GetName()]; ok {
+				b.callbacks.Connected(p)
+			}
+		}
+	}
+}
+
+// portRegistered is the JACK port registration callback. It hands the ports registered by other clients on.
+func (b *jackBackend) portRegistered(id jack.PortId, reg bool) {
+	if !reg {
+		return
+	}
+	if jp := b.client.GetPortById(id); jp != nil && !b.ownPort(jp.GetName()) {
+		b.callbacks.Registered(jp.GetName())
+	}
+}
+
+// ownPort reports whether a port belongs to the client.
+func (b *jackBackend) ownPort(name string) bool {
+	_, ok := b.ports[name]
+	return ok
+}
+
+func (b *jackBackend) Register(name string, p *Port, output bool) error {
+	var (
+		typ   = jack.DEFAULT_MIDI_TYPE
+		flags = jack.PortIsInput
+	)
+	if p.Type != "" {
+		typ = p.Type
+	}
+	if output {
+		flags = jack.PortIsOutput
+	}
+	port := b.client.PortRegister(name, typ, flags, 0)
+	if port == nil && p.Type != "" {
+		return errors.Errorf("registering %s (the server may not have %s ports)", name, p.Type)
+	}
+	if port == nil {
+		return errors.Errorf("registering %s", name)
+	}
+	p.name, p.handle = name, &jackPort{Port: port, output: output}
+	b.ports[port.GetName()] = p
+	return nil
+}
+
+func (b *jackBackend) Start(process func(nframes uint32) int) error {
+	if err := wrapCode(b.client.SetProcessCallback(process), "setting process callback"); err != nil {
+		return err
+	}
+	if err := wrapCode(b.client.Activate(), "activating JACK client"); err != nil {
+		return err
+	}
+	if b.callbacks.BufferSize != nil {
+		b.callbacks.BufferSize(b.client.GetBufferSize())
+	}
+	return nil
+}
+
+func (b *jackBackend) Close() error {
+	if b.client == nil {
+		return nil
+	}
+	err := wrapCode(b.client.Close(), "closing JACK client")
+	b.client = nil
+	return err
+}
+
+func (b *jackBackend) SampleRate() uint32 {
+	return b.client.GetSampleRate()
+}
+
+func (b *jackBackend) Devices(inputs bool) []string {
+	flags := jack.PortIsOutput
+	if inputs {
+		flags = jack.PortIsInput
+	}
+	var devices []string
+	for _, name := range b.client.GetPorts("", jack.DEFAULT_MIDI_TYPE, flags) {
+		if !b.ownPort(name) {
+			devices = append(devices, name)
+		}
+	}
+	return devices
+}
+
+func (b *jackBackend) Connect(p *Port, device string) error {
+	var (
+		own   = jackPortOf(p)
+		other = b.client.GetPortByName(device)
+	)
+	if other == nil {
+		return errors.Errorf("no port named %s", device)
+	}
+	if own.output {
+		return jack.Strerror(b.client.ConnectPorts(own.Port, other))
+	}
+	return jack.Strerror(b.client.ConnectPorts(other, own.Port))
+}
+
+func (b *jackBackend) Connections(p *Port) []string {
+	return jackPortOf(p).GetConnections()
+}
+
+func (b *jackBackend) Transport() (rolling bool, frame int64) {
+	state, pos := b.client.TransportQuery()
+	if state != jack.TransportRolling || pos == nil {
+		return false, 0
+	}
+	return true, int64(pos.Frame)
+}
+
+func (b *jackBackend) Events(p *Port, nframes uint32) []*MidiEvent {
+	jp := jackPortOf(p)
+	jp.events = jp.events[:0]
+	for _, e := range jp.GetMidiEvents(nframes) {
+		jp.events = append(jp.events, (*MidiEvent)(e))
+	}
+	return jp.events
+}
+
+func (b *jackBackend) Buffer(p *Port, nframes uint32) MidiBuffer {
+	return MidiBuffer(unsafe.Pointer(jackPortOf(p).MidiClearBuffer(nframes)))
+}
+
+// Write drops the events JACK has no room for, or that are out of order, without failing the period.
+func (b *jackBackend) Write(p *Port, event *MidiEvent, buffer MidiBuffer) int {
+	_ = jackPortOf(p).MidiEventWrite((*jack.MidiData)(event), jack.MidiBuffer((*[]byte)(buffer)))
+	return 0
+}
+
+func wrapCode(code int, msg string) error {
+	return errors.Wrap(jack.Strerror(code), msg)
+}
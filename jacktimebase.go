@@ -0,0 +1,62 @@
+package main
+
+/*
+#cgo linux LDFLAGS: -ljack
+#cgo darwin LDFLAGS: -ljack
+
+#include <jack/jack.h>
+#include <jack/transport.h>
+
+// ndseq_position is the position the timebase callback publishes, set by the process callback.
+// JACK calls the timebase callback right after the process callback, in the same thread.
+static jack_position_t ndseq_position;
+
+static jack_position_t *ndseq_next_position(void) {
+	return &ndseq_position;
+}
+
+static void ndseq_timebase(jack_transport_state_t state, jack_nframes_t nframes, jack_position_t *pos, int new_pos, void *arg) {
+	pos->valid = JackPositionBBT;
+	pos->bar = ndseq_position.bar;
+	pos->beat = ndseq_position.beat;
+	pos->tick = ndseq_position.tick;
+	pos->bar_start_tick = ndseq_position.bar_start_tick;
+	pos->beats_per_bar = ndseq_position.beats_per_bar;
+	pos->beat_type = ndseq_position.beat_type;
+	pos->ticks_per_beat = ndseq_position.ticks_per_beat;
+	pos->beats_per_minute = ndseq_position.beats_per_minute;
+}
+
+static int ndseq_set_timebase(jack_client_t *client) {
+	return jack_set_timebase_callback(client, 0, ndseq_timebase, NULL);
+}
+*/
+import "C"
+
+import (
+	"unsafe"
+
+	"github.com/pkg/errors"
+)
+
+// jackClientHandle returns the libjack client of the JACK client, for the calls the go-jack bindings don't wrap.
+// It is the first field of a go-jack Client.
+func (b *jackBackend) jackClientHandle() *C.jack_client_t {
+	return (*C.jack_client_t)(*(*unsafe.Pointer)(unsafe.Pointer(b.client)))
+}
+
+// Timebase takes over as timebase master even if another client is, as ndseq is only made master when asked to.
+func (b *jackBackend) Timebase() error {
+	if code := C.ndseq_set_timebase(b.jackClientHandle()); code != 0 {
+		return errors.Errorf("becoming JACK timebase master: error %d", int(code))
+	}
+	return nil
+}
+
+func (b *jackBackend) Publish(pos Position) {
+	p := C.ndseq_next_position()
+	p.bar, p.beat, p.tick = C.int32_t(pos.Bar), C.int32_t(pos.Beat), C.int32_t(pos.Tick)
+	p.bar_start_tick = C.double(pos.BarStartTick)
+	p.beats_per_bar, p.beat_type = C.float(pos.BeatsPerBar), C.float(pos.BeatType)
+	p.ticks_per_beat, p.beats_per_minute = C.double(pos.TicksPerBeat), C.double(pos.BeatsPerMinute)
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"github.com/pkg/errors"
+)
+
+var (
+	keyboardInput   *Port  // JACK port for receiving notes played on a MIDI keyboard.
+	keyboardPort    string // Pattern the keyboard's JACK ports are matched with (see portMatcher). Empty connects none.
+	keyboardChannel int    // Nord Drum channel the keyboard plays, from 1 to 16, or 0 for the focus track's.
+
+	// keyboardNotes holds the channel each note of the keyboard was sent on, plus one, and the note it was
+	// quantized to while it is held, so that its note off ends the same note if the channel or scale changes in between.
+	keyboardNotes [128]struct {
+		channel byte
+		note    byte
+	}
+)
+
+// setKeyboardPort sets the pattern the KeyboardIn port is connected by, from --keyboard.
+func setKeyboardPort() error {
+	if keyboardPort == "" {
+		return nil
+	}
+	m, err := portMatcher(keyboardPort)
+	if err != nil {
+		return errors.Wrap(err, "keyboard port")
+	}
+	Ports.Inputs["KeyboardIn"].Matches = m
+	return nil
+}
+
+// setKeyboardChannel sets the channel the keyboard plays, or 0 for the focus track's.
+func setKeyboardChannel(channel int) error {
+	if channel < 0 || channel > 16 {
+		return errors.Errorf("keyboard channel must be from 0 to 16, got %d", channel)
+	}
+	keyboardChannel = channel
+	return nil
+}
+
+// keyboardThru forwards the notes received on the KeyboardIn port to the Nord Drum,
+// on the keyboard channel whatever channel they were played on, quantized to the scale like every other note.
+// They are played while sequences run, and are not recorded (see recordNotes) or muted.
+func keyboardThru(nframes uint32) {
+	for _, event := range backend.Events(keyboardInput, nframes) {
+		in := event.Buffer
+		if len(in) < 3 || (in[0]&0xF0 != 0x80 && in[0]&0xF0 != 0x90) {
+			continue
+		}
+		var (
+			status = in[0] & 0xF0
+			note   = in[1] & 0x7F
+		)
+		if status == 0x90 && in[2] > 0 {
+			channel := trackConfigs[focus].channel()
+			if keyboardChannel > 0 {
+				channel = byte(keyboardChannel - 1)
+			} else if !trackConfigs[focus].assigned() {
+				continue
+			}
+			played := quantize(note)
+			keyboardNotes[note].channel, keyboardNotes[note].note = channel+1, played
+			queue(-1, event.Time, status|channel, played, in[2])
+			continue
+		}
+		if held := keyboardNotes[note]; held.channel > 0 {
+			keyboardNotes[note].channel = 0
+			queue(-1, event.Time, 0x80|(held.channel-1), held.note, in[2])
+		}
+	}
+}
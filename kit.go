@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// Kit is a named mapping of the tracks to channels and notes. Tracks past the end of a kit have no channel and play nothing.
+type Kit [8]TrackConfig
+
+var (
+	kitName    string // Name of the kit the tracks play. Empty keeps the tracks from --tracks, --channel or the profile.
+	baseTracks Kit    // Tracks played by patterns without a kit of their own.
+)
+
+// kits are the built-in kits, by name.
+var kits = map[string]Kit{
+	"nd3p": {
+		{Channel: 1, Note: ndNote, Label: "Channel 1"},
+		{Channel: 2, Note: ndNote, Label: "Channel 2"},
+		{Channel: 3, Note: ndNote, Label: "Channel 3"},
+		{Channel: 4, Note: ndNote, Label: "Channel 4"},
+		{Channel: 5, Note: ndNote, Label: "Channel 5"},
+		{Channel: 6, Note: ndNote, Label: "Channel 6"},
+	},
+	"gm": {
+		{Channel: 10, Note: 36, Label: "Kick"},
+		{Channel: 10, Note: 38, Label: "Snare"},
+		{Channel: 10, Note: 42, Label: "Closed hi-hat"},
+		{Channel: 10, Note: 46, Label: "Open hi-hat"},
+		{Channel: 10, Note: 39, Label: "Clap"},
+		{Channel: 10, Note: 45, Label: "Low tom"},
+		{Channel: 10, Note: 50, Label: "High tom"},
+		{Channel: 10, Note: 49, Label: "Crash"},
+	},
+}
+
+// kitsCommand prints the built-in kits.
+func kitsCommand(args []string) error {
+	if len(args) != 0 {
+		return errors.New("usage: ndseq kits")
+	}
+	names := make([]string, 0, len(kits))
+	for name := range kits {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		fmt.Println(name)
+		for track, c := range kits[name] {
+			if !c.assigned() {
+				continue
+			}
+			fmt.Printf("  %d\tchannel %d\tnote %d\t%s\n", track+1, c.Channel, c.Note, c.Label)
+		}
+	}
+	return nil
+}
+
+// lookupKit returns the built-in kit with a name.
+func lookupKit(name string) (Kit, error) {
+	k, ok := kits[name]
+	if !ok {
+		return k, errors.Errorf("unknown kit %q", name)
+	}
+	return k, nil
+}
+
+// setKit makes the tracks of patterns without a kit play a kit.
+// An empty name keeps the current tracks for them.
+func setKit(name string) error {
+	if name == "" {
+		baseTracks = trackConfigs
+		return nil
+	}
+	k, err := lookupKit(name)
+	if err != nil {
+		return err
+	}
+	kitName, baseTracks = name, k
+	useKit()
+	return nil
+}
+
+// useKit points the tracks at the playing pattern's kit, or the kit of patterns without one.
+// Unknown kits are rejected when the project is loaded, so they are ignored here.
+func useKit() {
+	trackConfigs = baseTracks
+	if k, ok := kits[bank[slot].Kit]; ok {
+		trackConfigs = k
+	}
+}
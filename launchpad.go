@@ -0,0 +1,561 @@
+package main
+
+import (
+	"bytes"
+
+	"github.com/pkg/errors"
+)
+
+// Launchpad is a variant of the Launchpad protocol, or of a grid controller that works like one.
+type Launchpad struct {
+	Name    string
+	Maker   []byte  // Manufacturer ID in the reply to a device inquiry, or nil for Novation.
+	Family  [2]byte // Family code in the reply to a device inquiry, least significant byte first. Zero if the model isn't detected.
+	Layout  layout  // How the pads and side buttons are numbered.
+	TopBase byte    // Number of the CC (or note, with TopNote) of the leftmost top-row button, if they are in a row.
+	TopNote bool    // Top-row buttons are notes instead of CCs.
+	SideCC  bool    // Side buttons are CCs instead of notes.
+	Colors  colors  // What the velocity of LED messages means.
+	Faders  byte    // CC number of the leftmost of the 8 track faders, or 0 if the model has none.
+	RGB     []byte  // Start of the sysex message that sets an LED to an RGB color, or nil if the model has none.
+	RGBMax  byte    // Full brightness of a color in RGB messages.
+	Batch   int     // Largest number of LEDs an RGB message can set, or 0 if it sets one.
+	Repeat  int     // Number of bytes at the end of RGB that are repeated before each LED of a message that sets several.
+	Strike  bool    // Pads send the velocity they are struck with.
+	Mode    []byte  // Start of the sysex message that selects (or, on its own, queries) programmer or live mode, or nil.
+}
+
+// layout is a way of numbering the pads and side buttons of a grid.
+type layout int
+
+const (
+	layout16   layout = iota // From 0 in the top left corner, 16 per row, side buttons in the ninth column.
+	layout10                 // From 11 in the bottom left corner, 10 per row, side buttons in the ninth column.
+	layoutAPC                // From 0 in the bottom left corner, 8 per row, side buttons from 82 at the top.
+	layoutFire               // The Akai Fire's 4 rows of 16 pads, tracks 5-8 on the right half (see fireNote).
+	layoutPush               // From 36 in the bottom left corner, 8 per row, side buttons CCs from 43 at the top.
+)
+
+// colors is a meaning of the velocity of LED messages.
+type colors int
+
+const (
+	colorsRG      colors = iota // Red and green brightness.
+	colorsPalette               // A color of the Novation palette.
+	colorsAPC                   // Green, red or yellow on the pads of the APC Mini, and on or off on its buttons.
+	colorsPush                  // A color of the Push 2's palette, whose first 16 are set by writePushPalette.
+)
+
+// apcSide is the note of the APC Mini's top side (scene launch) button.
+const apcSide = 82
+
+// launchpads are the Launchpad models ndseq knows how to drive. The first is the original Launchpad.
+// The Mk3 models are switched to programmer mode; the Pro must be put in programmer mode by hand.
+// The Akai APC Mini is driven like a Launchpad whose top row is the track buttons under its grid,
+// and the Akai Fire like one whose grid is cut in two halves side by side.
+// The Push 2 is switched to user mode, and its top row is the buttons under its display.
+var launchpads = []Launchpad{
+	{Name: "original", TopBase: 0x68},
+	{Name: "s", Family: [2]byte{0x20, 0x00}, TopBase: 0x68},
+	{Name: "mini", Family: [2]byte{0x36, 0x00}, TopBase: 0x68},
+	{Name: "mk2", Family: [2]byte{0x69, 0x00}, Layout: layout10, TopBase: 0x68, Colors: colorsPalette, RGB: []byte{0xF0, 0x00, 0x20, 0x29, 0x02, 0x18, 0x0B}, RGBMax: 63, Batch: 80},
+	{Name: "pro", Family: [2]byte{0x51, 0x00}, Layout: layout10, TopBase: 91, SideCC: true, Colors: colorsPalette, RGB: []byte{0xF0, 0x00, 0x20, 0x29, 0x02, 0x10, 0x0B}, RGBMax: 63, Batch: 80, Strike: true},
+	{Name: "mini-mk3", Family: [2]byte{0x13, 0x01}, Layout: layout10, TopBase: 91, SideCC: true, Colors: colorsPalette, RGB: []byte{0xF0, 0x00, 0x20, 0x29, 0x02, 0x0D, 0x03, 0x03}, RGBMax: 127, Batch: 81, Repeat: 1, Mode: []byte{0xF0, 0x00, 0x20, 0x29, 0x02, 0x0D, 0x0E}},
+	{Name: "x", Family: [2]byte{0x03, 0x01}, Layout: layout10, TopBase: 91, SideCC: true, Colors: colorsPalette, RGB: []byte{0xF0, 0x00, 0x20, 0x29, 0x02, 0x0C, 0x03, 0x03}, RGBMax: 127, Batch: 81, Repeat: 1, Strike: true, Mode: []byte{0xF0, 0x00, 0x20, 0x29, 0x02, 0x0C, 0x0E}},
+	{Name: "pro-mk3", Family: [2]byte{0x23, 0x01}, Layout: layout10, TopBase: 91, SideCC: true, Colors: colorsPalette, RGB: []byte{0xF0, 0x00, 0x20, 0x29, 0x02, 0x0E, 0x03, 0x03}, RGBMax: 127, Batch: 81, Repeat: 1, Strike: true, Mode: []byte{0xF0, 0x00, 0x20, 0x29, 0x02, 0x0E, 0x0E}},
+	{Name: "apc-mini", Maker: akai, Family: [2]byte{0x28, 0x00}, Layout: layoutAPC, TopBase: 64, TopNote: true, Colors: colorsAPC, Faders: 48},
+	{Name: "fire", Maker: akai, Family: [2]byte{0x43, 0x00}, Layout: layoutFire, TopNote: true, RGB: []byte{0xF0, 0x47, 0x7F, 0x43, 0x65, 0x00, 0x04}, RGBMax: 127, Batch: 64, Strike: true},
+	{Name: "push2", Maker: ableton, Family: [2]byte{0x67, 0x32}, Layout: layoutPush, TopBase: 20, SideCC: true, Colors: colorsPush, Strike: true, Mode: []byte{0xF0, 0x00, 0x21, 0x1D, 0x01, 0x01, 0x0A}},
+}
+
+// midiGrid drives a Launchpad, or a controller that works like one, on a pair of Launchpad ports.
+type midiGrid struct {
+	model  *Launchpad // Model of the connected Launchpad.
+	in     *Port      // Port the Launchpad's messages are received on.
+	out    *Port      // Port the Launchpad's LEDs are set on.
+	buffer MidiBuffer // Buffer of out for the current cycle (see clearGridBuffers).
+
+	inquired     bool // Flag telling us if the device inquiry has been sent to the Launchpad.
+	programmer   bool // Flag telling us if the Launchpad has been switched to programmer mode.
+	released     bool // Flag telling us if the Launchpad has been put back in its previous mode for good.
+	previousMode byte // Mode the Launchpad was in before programmer mode, from its reply to the mode query.
+	flashes      bool // Flag telling us if the Launchpad has been told to flash LEDs on its own.
+
+	// While painting, LED changes are collected in leds or changes and sent together (see BeginPaint).
+	painting   bool
+	leds       [rapidLEDs]byte
+	changes    [maxChanges]ledChange
+	numChanges int
+	batch      [batchBytes]byte // Buffer the batched messages are built in.
+}
+
+var (
+	launchpad     = &midiGrid{model: &launchpads[0]} // Launchpad on the LaunchpadRecv and LaunchpadSend ports.
+	launchpadName string                             // Name of the model given on the command line, or "auto" to detect it.
+	paletteLEDs   bool                               // Flag telling us if RGB models are lit from their palette instead of with RGB messages.
+	aftertouch    bool                               // Flag telling us if pressing harder on a held step raises its velocity.
+
+	// rgbMessage is the buffer RGB LED and mode messages are built in, so lighting an LED doesn't allocate.
+	rgbMessage [32]byte
+
+	// resetMessage turns the LEDs of the red and green models off and resets their settings.
+	resetMessage = []byte{0xB0, 0x00, 0x00}
+
+	// deviceInquiry asks the Launchpad which model it is.
+	deviceInquiry = []byte{0xF0, 0x7E, 0x7F, 0x06, 0x01, 0xF7}
+
+	// novation and akai are the manufacturer IDs in sysex messages from Novation and Akai devices.
+	novation = []byte{0x00, 0x20, 0x29}
+	akai     = []byte{0x47}
+
+	// paletteColors are the colors of the Novation palette nearest to each green and red brightness of the original Launchpad.
+	paletteColors = [4][4]byte{
+		{0, 7, 6, 5},
+		{23, 15, 11, 60},
+		{22, 17, 13, 84},
+		{21, 17, 13, 9},
+	}
+
+	// apcColors are the APC Mini pad colors for no, some green and some red: off, green, red and yellow.
+	apcColors = [2][2]byte{
+		{0, 3},
+		{1, 5},
+	}
+)
+
+// detectLaunchpad handles a reply to the device inquiry and switches to the protocol of the model it names.
+// The grid is repainted on the next cycle in the model's format. Unknown models keep the current protocol.
+func (lp *midiGrid) detectLaunchpad(in []byte) {
+	// F0 7E <device> 06 02 <manufacturer> <family> <member> <version> F7
+	if len(in) < 10 || in[1] != 0x7E || in[3] != 0x06 || in[4] != 0x02 {
+		return
+	}
+	maker := in[5:6] // Manufacturer IDs are one byte, or three starting with 0.
+	if in[5] == 0 {
+		maker = in[5:8]
+	}
+	family := in[5+len(maker):]
+
+	for i := range launchpads {
+		if l := &launchpads[i]; i > 0 && l.Family != [2]byte{} && bytes.Equal(maker, l.maker()) && family[0] == l.Family[0] && family[1] == l.Family[1] && l != lp.model {
+			lp.model = l
+			gridPainted = false
+			return
+		}
+	}
+}
+
+// maker returns the manufacturer ID of a model.
+func (l *Launchpad) maker() []byte {
+	if l.Maker == nil {
+		return novation
+	}
+	return l.Maker
+}
+
+// enterProgrammerMode switches models with modes to programmer mode the first time it is called for them,
+// after asking which mode they are in so it can be restored on exit (see leaveProgrammerMode).
+func (lp *midiGrid) enterProgrammerMode() int {
+	if lp.model.Mode == nil || lp.programmer || lp.released {
+		return 0
+	}
+	lp.programmer = true
+	gridPainted = false
+
+	if code := lp.writeMode(-1); isFailure(code) {
+		return code
+	}
+	if code := lp.writeMode(1); isFailure(code) || lp.model.Colors != colorsPush {
+		return code
+	}
+	return lp.writePushPalette()
+}
+
+// leaveProgrammerMode puts the Launchpad back in its previous mode for good.
+func (lp *midiGrid) leaveProgrammerMode() int {
+	lp.released = true
+	if !lp.programmer {
+		return 0
+	}
+	lp.programmer = false
+	return lp.writeMode(int(lp.previousMode))
+}
+
+// modeReply handles the Launchpad's reply to the mode query.
+func (lp *midiGrid) modeReply(in []byte) {
+	if n := len(lp.model.Mode); lp.model.Mode != nil && len(in) == n+2 && bytes.HasPrefix(in, lp.model.Mode) {
+		lp.previousMode = in[n]
+	}
+}
+
+// writeMode selects a mode of the Launchpad, or asks which one it is in if mode is negative.
+func (lp *midiGrid) writeMode(mode int) int {
+	n := copy(rgbMessage[:], lp.model.Mode)
+	if mode >= 0 {
+		rgbMessage[n] = byte(mode)
+		n++
+	}
+	rgbMessage[n] = 0xF7
+	return lp.write(rgbMessage[:n+1])
+}
+
+// inquire sends the device inquiry to the Launchpad the first time it is called.
+func (lp *midiGrid) inquire() int {
+	if lp.inquired {
+		return 0
+	}
+	lp.inquired = true
+	return lp.write(deviceInquiry)
+}
+
+// write writes a message to the Launchpad.
+func (lp *midiGrid) write(data []byte) int {
+	return backend.Write(lp.out, &MidiEvent{Buffer: data}, lp.buffer)
+}
+
+// lightLED sets an LED, addressed by the status byte and number of its note or CC, to a green and red brightness.
+// The LED flashes if flash is added to the green brightness and the model can flash it.
+// Models with RGB messages get the brightness as the green and red parts of an RGB color, unless --palette-leds is given.
+func (lp *midiGrid) lightLED(status, number byte, g, r int) int {
+	if lp.model.Layout == layoutFire {
+		return lp.lightFire(number, g&3, r)
+	}
+	if lp.model.Colors == colorsAPC && number >= gridSize*gridSize && (g&3)+r > 0 {
+		g, r = 1|(g&flash), 0 // Buttons only turn on.
+	}
+	if lp.collect(status, number, g, r) {
+		return 0
+	}
+	if g&flash != 0 {
+		if code, ok := lp.flashLED(status, number, g&3, r); ok {
+			return code
+		}
+	}
+	g &= 3
+	if lp.model.RGB == nil || paletteLEDs {
+		return lp.write([]byte{status, number, lp.ledVelocity(g, r)})
+	}
+	n := copy(rgbMessage[:], lp.model.RGB)
+	n += copy(rgbMessage[n:], []byte{number, lp.rgbLevel(r), lp.rgbLevel(g), 0, 0xF7})
+
+	return lp.write(rgbMessage[:n])
+}
+
+// rgbLevel returns the level of an RGB color part for a brightness from 0 (off) to 3 (full).
+func (lp *midiGrid) rgbLevel(brightness int) byte {
+	return byte(brightness&3) * lp.model.RGBMax / 3
+}
+
+// ledVelocity returns the velocity that sets an LED to a green and red brightness, from 0 (off) to 3 (full).
+func (lp *midiGrid) ledVelocity(g, r int) byte {
+	switch lp.model.Colors {
+	case colorsPalette:
+		return paletteColors[g&3][r&3]
+	case colorsAPC:
+		return apcColors[lit(g)][lit(r)]
+	case colorsPush:
+		return byte((4 * (g & 3)) + (r & 3))
+	}
+	return byte((16 * g) + r + 8 + 4)
+}
+
+// lit returns 1 if a brightness is on and 0 if it is off.
+func lit(brightness int) int {
+	if brightness&3 == 0 {
+		return 0
+	}
+	return 1
+}
+
+// setLaunchpad selects the protocol of a Launchpad model by name, or the monome grid controller.
+// "auto" keeps the original Launchpad's until the model replies to the device inquiry.
+func setLaunchpad(name string) error {
+	if name == "monome" {
+		grid = monomeGrid{}
+		return nil
+	}
+	return launchpad.setModel(name)
+}
+
+// setModel selects the protocol of a Launchpad model by name, or detects it if the name is "auto".
+func (lp *midiGrid) setModel(name string) error {
+	if name == "auto" {
+		return nil
+	}
+	for i := range launchpads {
+		if launchpads[i].Name == name {
+			lp.model, lp.inquired = &launchpads[i], true
+			return nil
+		}
+	}
+	return errors.Errorf("unknown launchpad %q", name)
+}
+
+// padNote returns the number of the note (or, for side buttons of some models, the CC) of the pad at column x and row y.
+// Rows are counted from the top and the side buttons are in column sideColumn.
+func (lp *midiGrid) padNote(x, y int) byte {
+	switch lp.model.Layout {
+	case layout10:
+		return byte((10 * (gridSize - y)) + x + 1)
+	case layoutAPC:
+		if x == sideColumn {
+			return byte(apcSide + y)
+		}
+		return byte((gridSize * (gridSize - 1 - y)) + x)
+	case layoutFire:
+		return fireNote(x, y)
+	case layoutPush:
+		if x == sideColumn {
+			return byte(pushSide - y)
+		}
+		return byte(pushPad + (gridSize * (gridSize - 1 - y)) + x)
+	}
+	return byte(x + (16 * y))
+}
+
+// padXY returns the column and row of the pad (or side button) with a note number.
+func (lp *midiGrid) padXY(note byte) (x, y int, ok bool) {
+	switch lp.model.Layout {
+	case layout10:
+		row, col := int(note)/10, int(note)%10
+		if row < 1 || row > gridSize || col < 1 || col > sideColumn+1 {
+			return 0, 0, false
+		}
+		return col - 1, gridSize - row, true
+	case layoutAPC:
+		if n := int(note); n >= apcSide && n < apcSide+gridSize {
+			return sideColumn, n - apcSide, true
+		}
+		if note >= gridSize*gridSize {
+			return 0, 0, false
+		}
+		return int(note) % gridSize, gridSize - 1 - (int(note) / gridSize), true
+	case layoutFire:
+		return fireXY(note)
+	case layoutPush:
+		i := int(note) - pushPad // The side buttons are CCs with the same numbers as some pads (see sideCC).
+		if i < 0 || i >= gridSize*gridSize {
+			return 0, 0, false
+		}
+		return i % gridSize, gridSize - 1 - (i / gridSize), true
+	}
+	x, y = int(note&0x0F), int(note>>4)
+	return x, y, x <= sideColumn && y < gridSize
+}
+
+// sideCC returns the row of the side button with a CC number, on models whose side buttons are CCs.
+func (lp *midiGrid) sideCC(number byte) (y int, ok bool) {
+	if !lp.model.SideCC {
+		return 0, false
+	}
+	if lp.model.Layout == layoutPush {
+		y = pushSide - int(number)
+		return y, y >= 0 && y < gridSize
+	}
+	x, y, ok := lp.padXY(number)
+	return y, ok && x == sideColumn
+}
+
+// topNumber returns the number of the CC or note of the top-row button for a bank slot.
+func (lp *midiGrid) topNumber(i int) byte {
+	if lp.model.Layout == layoutFire {
+		return fireTop[i]
+	}
+	return lp.model.TopBase + byte(i)
+}
+
+// topSlot returns the bank slot of the top-row button with a CC or note number, or -1 if it isn't one.
+func (lp *midiGrid) topSlot(number byte) int {
+	if lp.model.Layout == layoutFire {
+		return fireTopSlot(number)
+	}
+	if i := int(number) - int(lp.model.TopBase); i >= 0 && i < numSlots {
+		return i
+	}
+	return -1
+}
+
+// Start sends the device inquiry, switches the model to programmer mode and turns on flashing.
+func (lp *midiGrid) Start(ledBuffer MidiBuffer) int {
+	if code := lp.inquire(); isFailure(code) {
+		return code
+	}
+	if code := lp.enterProgrammerMode(); isFailure(code) {
+		return code
+	}
+	return lp.enableFlashing()
+}
+
+// reconnect sets the Launchpad up again once it has been plugged back in, and repaints the grid
+// so that it shows the pattern, mutes and playhead again. The model isn't detected again.
+func (lp *midiGrid) reconnect() {
+	lp.programmer, lp.flashes = false, false
+	gridPainted = false
+}
+
+// hasPort reports whether a port is one of the Launchpad's.
+func (lp *midiGrid) hasPort(p *Port) bool {
+	return p != nil && (p == lp.in || p == lp.out)
+}
+
+// portConnected is the backend's callback for connections to ndseq's ports.
+// A connection to one of a Launchpad's ports, as when it is plugged back in, reconnects it (see reconnect).
+func portConnected(p *Port) {
+	for _, lp := range []*midiGrid{launchpad, launchpad2} {
+		if !lp.hasPort(p) {
+			continue
+		}
+		select {
+		case commands <- lp.reconnect:
+		default: // Backend callbacks must not block.
+		}
+	}
+}
+
+// Stop turns the LEDs off and puts the model back in the mode it was in before ndseq started.
+func (lp *midiGrid) Stop(ledBuffer MidiBuffer) int {
+	if code := lp.clearLEDs(ledBuffer); isFailure(code) {
+		return code
+	}
+	return lp.leaveProgrammerMode()
+}
+
+// clearLEDs turns every LED off.
+// The red and green models are sent the reset message, which also puts their buffers and layout back;
+// the others have every LED set to off.
+func (lp *midiGrid) clearLEDs(ledBuffer MidiBuffer) int {
+	if lp.model.Colors == colorsRG {
+		return lp.write(resetMessage)
+	}
+	lp.BeginPaint()
+	for y := 0; y < gridSize; y++ {
+		for x := 0; x <= sideColumn; x++ {
+			if code := lp.Light(x, y, 0, 0, ledBuffer); isFailure(code) {
+				return code
+			}
+		}
+	}
+	for i := 0; i < numSlots; i++ {
+		if code := lp.LightTop(i, 0, 0, ledBuffer); isFailure(code) {
+			return code
+		}
+	}
+	return lp.EndPaint(ledBuffer)
+}
+
+// Events turns the messages received on the Launchpad's port into grid events.
+// Replies to the device inquiry and mode query are handled here.
+// Channel messages are taken on any channel, so that controllers sending on other channels than the first work too.
+func (lp *midiGrid) Events(nframes uint32, events []GridEvent) []GridEvent {
+	for _, event := range backend.Events(lp.in, nframes) {
+		in := event.Buffer
+		if len(in) < 3 {
+			continue // Sysex messages are never this short either.
+		}
+		var (
+			e  GridEvent
+			ok bool
+		)
+		status := in[0]
+		if status < 0xF0 {
+			status &= 0xF0
+		}
+		switch status {
+		case 0xB0: // CC
+			e, ok = lp.ccEvent(in[1], in[2])
+		case 0x80, 0x90: // Note
+			e, ok = lp.noteEvent(in[1], status == 0x90 && in[2] > 0, in[2])
+		case 0xA0: // Polyphonic aftertouch
+			e.Kind, e.Value = GridPressure, int(in[2])
+			e.X, e.Y, ok = lp.padXY(in[1])
+			ok = ok && e.X != sideColumn && aftertouch && lp.model.Strike
+		case 0xF0: // Sysex
+			lp.detectLaunchpad(in)
+			lp.modeReply(in)
+		}
+		if ok && len(events) < cap(events) {
+			events = append(events, e)
+		}
+	}
+	return events
+}
+
+// Light sets the LED of a pad or side button.
+func (lp *midiGrid) Light(x, y, g, r int, ledBuffer MidiBuffer) int {
+	status := byte(0x90)
+	if x == sideColumn && lp.model.SideCC {
+		status = 0xB0
+	}
+	return lp.lightLED(status, lp.padNote(x, y), g, r)
+}
+
+// LightTop sets the LED of a top-row button.
+func (lp *midiGrid) LightTop(i, g, r int, ledBuffer MidiBuffer) int {
+	status := byte(0xB0)
+	if lp.model.TopNote {
+		status = 0x90
+	}
+	return lp.lightLED(status, lp.topNumber(i), g, r)
+}
+
+// Encoders returns the number of the Push 2's encoders, which lock parameters.
+func (lp *midiGrid) Encoders() int {
+	if lp.model.Layout == layoutPush {
+		return gridSize
+	}
+	return 0
+}
+
+// ccEvent returns the grid event of a CC from the Launchpad port:
+// top-row buttons, side buttons on models whose side buttons are CCs, faders and encoders.
+func (lp *midiGrid) ccEvent(number, value byte) (GridEvent, bool) {
+	if i := lp.topSlot(number); i >= 0 && !lp.model.TopNote {
+		return GridEvent{Kind: GridTop, X: i, Pressed: value > 0}, true
+	}
+	if i := int(number) - fireEncoder; lp.model.Layout == layoutFire && i >= 0 && i < 3 {
+		return GridEvent{Kind: GridTempo + GridEventKind(i), Value: encoderSteps(value)}, true
+	}
+	if i := int(number) - int(lp.model.Faders); lp.model.Faders > 0 && i >= 0 && i < len(trackConfigs) {
+		return GridEvent{Kind: GridFader, X: i, Value: int(value)}, true
+	}
+	if y, ok := lp.sideCC(number); ok {
+		return GridEvent{Kind: GridSide, Y: y, Pressed: value > 0}, true
+	}
+	if i := int(number) - pushEncoder; lp.model.Layout == layoutPush && i >= 0 && i < gridSize {
+		return GridEvent{Kind: GridEncoder, X: i, Value: encoderSteps(value)}, true
+	}
+	if i := int(number) - pushPage; lp.model.Layout == layoutPush && i >= 0 && i < 2 && value > 0 {
+		return GridEvent{Kind: GridPage, Value: (2 * i) - 1}, true
+	}
+	return GridEvent{}, false
+}
+
+// noteEvent returns the grid event of a note from the Launchpad port: pads, side buttons, and top-row buttons on models whose top-row buttons are notes.
+// Pads of models that aren't velocity-sensitive get the default velocity.
+func (lp *midiGrid) noteEvent(number byte, pressed bool, velocity byte) (GridEvent, bool) {
+	if i := lp.topSlot(number); i >= 0 && lp.model.TopNote {
+		return GridEvent{Kind: GridTop, X: i, Pressed: pressed}, true
+	}
+	x, y, ok := lp.padXY(number)
+	if !ok {
+		return GridEvent{}, false
+	}
+	if x == sideColumn {
+		return GridEvent{Kind: GridSide, Y: y, Pressed: pressed}, true
+	}
+	e := GridEvent{Kind: GridPad, X: x, Y: y, Pressed: pressed}
+	if lp.model.Strike {
+		e.Value = int(velocity)
+	}
+	return e, true
+}
+
+// encoderSteps returns the number of steps a relative encoder turned by from the value of its CC:
+// 1 to 63 clockwise and 127 down to 65 counterclockwise.
+func encoderSteps(value byte) int {
+	steps := int(value & 0x7F)
+	if steps >= 64 {
+		steps -= 128
+	}
+	return steps
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"github.com/pkg/errors"
+)
+
+// Layer is an extra destination a track's hits are sent to, on top of the track's own channel and note.
+type Layer struct {
+	Channel int   `json:"channel"`        // MIDI channel, from 1 to 16.
+	Note    uint8 `json:"note,omitempty"` // Note the layer plays. Zero plays the notes of the track's hits.
+}
+
+// channel returns the zero-based MIDI channel of the layer's messages.
+func (l Layer) channel() byte {
+	return byte(l.Channel-1) & 0x0F
+}
+
+// note returns the note the layer plays for a note of the track.
+func (l Layer) note(note uint8) uint8 {
+	if l.Note > 0 {
+		return l.Note
+	}
+	return note
+}
+
+// validate checks that a layer has a valid channel and note.
+func (l Layer) validate() error {
+	if l.Channel < 1 || l.Channel > 16 {
+		return errors.New("layer channel must be between 1 and 16")
+	}
+	if l.Note > 127 {
+		return errors.New("layer note must be between 0 and 127")
+	}
+	return nil
+}
+
+// scheduleLayers schedules the hits of a trig on a track's layers.
+// Layers with their own note play it once, whatever the chord; the others play every note of the trig.
+func scheduleLayers(track, step int, offset, length, nframes uint32, notes []uint8, velocity byte) {
+	for _, l := range trackConfigs[track].Layers {
+		if l.Note > 0 {
+			scheduleRatchets(track, step, offset, length, nframes, l.channel(), l.Note, velocity)
+			continue
+		}
+		for _, note := range notes {
+			scheduleRatchets(track, step, offset, length, nframes, l.channel(), quantize(note), velocity)
+		}
+	}
+}
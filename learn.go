@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	learnPath  string              // Track config file the learned mapping is written to. Empty disables learning.
+	learnTrack = -1                // Track waiting for a note in learn mode, or -1 when not learning.
+	learned    = make(chan Kit, 1) // Mappings learned in the process callback, for the main goroutine to write.
+)
+
+// learnNote assigns the channel and note of a note on received from the Nord Drum to the track being learned,
+// then moves on to the next track. Once every track is learned the mapping is sent to learned.
+func learnNote(in []byte, ledBuffer MidiBuffer) int {
+	if learnTrack < 0 || len(in) < 3 || in[0]&0xF0 != 0x90 || in[2] == 0 {
+		return 0
+	}
+	track := learnTrack
+	trackConfigs[track].Channel, trackConfigs[track].Note = int(in[0]&0x0F)+1, in[1]
+	learnTrack++
+
+	if learnTrack == len(trackConfigs) {
+		learnTrack = -1
+		kitName, baseTracks = "", trackConfigs
+		select {
+		case learned <- trackConfigs:
+		default: // The previous mapping has not been written yet.
+		}
+	}
+	if code := lightSide(track, ledBuffer); isFailure(code) {
+		return code
+	}
+	if learnTrack < 0 {
+		return 0
+	}
+	return lightSide(learnTrack, ledBuffer)
+}
+
+// startLearning starts learn mode from the first track, if a file to write the mapping to was given.
+func startLearning() {
+	if learnPath == "" {
+		return
+	}
+	learnTrack = 0
+	gridPainted = false
+}
+
+// writeTracks writes track configs to a file that can be read with --tracks.
+func writeTracks(path string, k Kit) error {
+	data, err := json.MarshalIndent(k, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "encoding tracks")
+	}
+	return errors.Wrap(os.WriteFile(path, data, 0644), "writing track config file")
+}
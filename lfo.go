@@ -0,0 +1,191 @@
+package main
+
+import (
+	"math"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	lfoInterval  = 128  // Number of samples between LFO updates.
+	lfoSmoothing = 0.25 // Weight of the target value in each update, to smooth jumps.
+)
+
+// Shape is the waveform of an LFO.
+type Shape uint8
+
+// LFO waveforms.
+const (
+	shapeSine Shape = iota
+	shapeSaw
+	shapeSquare
+	shapeSampleHold
+	numShapes
+)
+
+var shapeNames = [numShapes]string{"sine", "saw", "square", "sh"}
+
+// MarshalText encodes the shape as its name.
+func (s Shape) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// String returns the name of the shape.
+func (s Shape) String() string {
+	if s >= numShapes {
+		return shapeNames[shapeSine]
+	}
+	return shapeNames[s]
+}
+
+// UnmarshalText decodes a shape from its name.
+// The empty name is a sine.
+func (s *Shape) UnmarshalText(text []byte) error {
+	if len(text) == 0 {
+		*s = shapeSine
+		return nil
+	}
+	for i, name := range shapeNames {
+		if name == string(text) {
+			*s = Shape(i)
+			return nil
+		}
+	}
+	return errors.Errorf("unknown LFO shape %q", string(text))
+}
+
+// LFO modulates a Nord Drum CC on a track's channel, in time with the tempo.
+type LFO struct {
+	Track  int     `json:"track"`
+	CC     CC      `json:"cc"`
+	Shape  Shape   `json:"shape"`
+	Beats  float64 `json:"beats"`  // Length of a cycle in beats.
+	Depth  uint8   `json:"depth"`  // Largest distance of the CC value from the center.
+	Center uint8   `json:"center"` // CC value the LFO swings around.
+}
+
+// lfoState is the running state of an LFO.
+type lfoState struct {
+	phase  float64 // Position in the cycle, from 0 to 1.
+	held   float64 // Current sample and hold level, from -1 to 1.
+	value  float64 // Smoothed CC value.
+	sent   int     // Last CC value sent (with 14 bits if the track sends the CC with 14 bits), or -1.
+	offset uint32  // Offset of the next update from the start of the current period.
+}
+
+var (
+	lfos      []LFO      // LFOs of the project.
+	lfoStates []lfoState // Running state of each LFO.
+)
+
+// level returns the LFO's waveform at its current phase, from -1 to 1.
+func (l LFO) level(st *lfoState) float64 {
+	switch l.Shape {
+	case shapeSaw:
+		return (2 * st.phase) - 1
+	case shapeSquare:
+		if st.phase < 0.5 {
+			return 1
+		}
+		return -1
+	case shapeSampleHold:
+		return st.held
+	}
+	return math.Sin(2 * math.Pi * st.phase)
+}
+
+// validate checks that the LFO has a track, a cycle length and a CC.
+func (l LFO) validate() error {
+	if l.Track < 0 || l.Track >= 8 {
+		return errors.New("track must be between 0 and 7")
+	}
+	if l.Beats <= 0 {
+		return errors.New("beats must be greater than 0")
+	}
+	if l.CC > 119 || l.Depth > 127 || l.Center > 127 {
+		return errors.New("cc must be between 0 and 119, depth and center between 0 and 127")
+	}
+	return nil
+}
+
+// runLFOs queues the CC messages of every LFO for the current period.
+// Each LFO is updated every lfoInterval samples and only sends its CC when the value changes.
+func runLFOs(nframes uint32) {
+	if samplesPerBeat == 0 {
+		return
+	}
+	for i, l := range lfos {
+		st := &lfoStates[i]
+		step := float64(lfoInterval) / (float64(samplesPerBeat) * l.Beats)
+
+		for ; st.offset < nframes; st.offset += lfoInterval {
+			target := float64(l.Center) + (float64(l.Depth) * l.level(st))
+			st.value += lfoSmoothing * (target - st.value)
+
+			if trackConfigs[l.Track].fine(l.CC) {
+				st.sendFine(l, clampFine(st.value))
+			} else if v := clampCC(st.value); v != st.sent {
+				queue(l.Track, st.offset, 0xB0|trackConfigs[l.Track].channel(), byte(l.CC), byte(v))
+				st.sent = v
+			}
+			st.phase += step
+			if st.phase >= 1 {
+				st.phase -= math.Floor(st.phase)
+				st.held = (float64(rand()%2001) / 1000) - 1
+			}
+		}
+		st.offset -= nframes
+	}
+}
+
+// clampCC rounds a CC value and limits it to 0-127.
+func clampCC(v float64) int {
+	switch {
+	case v < 0:
+		return 0
+	case v > 127:
+		return 127
+	}
+	return int(v + 0.5)
+}
+
+// sendFine queues the 14-bit value of an LFO whose track sends its CC with 14 bits, if the value changed.
+// The MSB is only sent when it changes.
+func (st *lfoState) sendFine(l LFO, v int) {
+	if v == st.sent {
+		return
+	}
+	channel := trackConfigs[l.Track].channel()
+	if st.sent < 0 || v>>7 != st.sent>>7 {
+		queue(l.Track, st.offset, 0xB0|channel, byte(l.CC), byte(v>>7))
+	}
+	queue(l.Track, st.offset, 0xB0|channel, byte(l.CC)+fineOffset, byte(v&0x7F))
+	st.sent = v
+}
+
+// clampFine converts a CC value to 14 bits, rounded and limited to 0-16383.
+func clampFine(v float64) int {
+	switch {
+	case v < 0:
+		return 0
+	case v*128 > 16383:
+		return 16383
+	}
+	return int((v * 128) + 0.5)
+}
+
+// setLFOs validates LFOs and resets their running state.
+func setLFOs(l []LFO) error {
+	for i := range l {
+		if err := l[i].validate(); err != nil {
+			return errors.Wrapf(err, "lfo %d", i)
+		}
+	}
+	lfos = l
+	lfoStates = make([]lfoState, len(l))
+
+	for i := range lfoStates {
+		lfoStates[i] = lfoState{value: float64(l[i].Center), sent: -1}
+	}
+	return nil
+}
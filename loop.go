@@ -0,0 +1,72 @@
+package main
+
+var (
+	loopStart = 0  // First step of the loop.
+	loopEnd   = -1 // Last step of the loop, or -1 to loop the whole pattern.
+)
+
+// clearLoop plays the whole pattern again.
+func clearLoop() {
+	loopStart, loopEnd = 0, -1
+}
+
+// loopFirst returns the first step that is played.
+func loopFirst() int {
+	if loopEnd < 0 || loopStart >= steps {
+		return 0
+	}
+	return loopStart
+}
+
+// loopLength returns the number of steps that are played.
+func loopLength() int {
+	if loopEnd < 0 || loopStart >= steps {
+		return steps
+	}
+	end := loopEnd
+	if end >= steps {
+		end = steps - 1
+	}
+	return end - loopStart + 1
+}
+
+// loopPad handles a pad press on a step while a top-row button is held.
+// Pads in the second row set the first step of the loop and pads in the third row set the last one.
+// Pads in the fourth row clear the loop. Other rows are ignored.
+func loopPad(y, step int) {
+	switch y {
+	case 1:
+		loopStart = step
+		if loopEnd < 0 {
+			loopEnd = steps - 1
+		}
+	case 2:
+		loopEnd = step
+	case 3:
+		clearLoop()
+		return
+	default:
+		return
+	}
+	if loopEnd < loopStart {
+		loopStart, loopEnd = loopEnd, loopStart
+	}
+}
+
+// prevBeat returns the master step before a step, wrapping around at the start of the loop.
+func prevBeat(step int) int {
+	first := loopFirst()
+	if step <= first || step >= first+loopLength() {
+		return first + loopLength() - 1
+	}
+	return step - 1
+}
+
+// nextBeat returns the master step after a step, wrapping around at the end of the loop.
+func nextBeat(step int) int {
+	first := loopFirst()
+	if step < first || step+1 >= first+loopLength() {
+		return first
+	}
+	return step + 1
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"github.com/pkg/errors"
+)
+
+const (
+	markovOrder  = 2                // Number of previous steps a track's next trig depends on.
+	markovStates = 1 << markovOrder // Number of distinct histories.
+)
+
+// markovModel predicts whether a track's next step has a trig from the trigs of
+// the steps before it.
+type markovModel struct {
+	hits     [markovStates]int // Number of trigs that followed each history.
+	total    [markovStates]int // Number of steps that followed each history.
+	velocity uint8             // Average velocity of the track's trigs.
+}
+
+var (
+	variation int            // Percentage of steps that are generated instead of played as programmed.
+	models    [8]markovModel // Markov models indexed by track, trained on the playing pattern.
+	histories [8]uint8       // Last markovOrder played steps of each track, one bit per step.
+)
+
+// generate returns the trig to play for a track's step.
+// With variation the step is drawn from the track's model instead of the pattern
+// some of the time, and the track's history is updated with what was played.
+func generate(track, step int) uint8 {
+	trig := trigs[track][step]
+
+	if variation > 0 && chance(uint8(variation)) {
+		m := &models[track]
+		h := histories[track]
+
+		if m.total[h] > 0 && int(rand()%uint32(m.total[h])) < m.hits[h] {
+			trig = m.velocity
+		} else {
+			trig = 0
+		}
+	}
+	histories[track] = ((histories[track] << 1) | boolBit(trig > 0)) & (markovStates - 1)
+	return trig
+}
+
+// boolBit returns 1 for true and 0 for false.
+func boolBit(b bool) uint8 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// setVariation validates and sets the variation amount.
+func setVariation(amount int) error {
+	if amount < 0 || amount > 100 {
+		return errors.New("variation must be between 0 and 100")
+	}
+	variation = amount
+	return nil
+}
+
+// trainModels retrains every track's model on the playing pattern.
+// The pattern is treated as a loop, so the first steps follow the last ones.
+func trainModels() {
+	for track := range models {
+		var (
+			m        = markovModel{}
+			h        uint8
+			sum, hit int
+		)
+		for i := 0; i < steps+markovOrder; i++ {
+			on := trigs[track][i%steps] > 0
+
+			if i >= markovOrder {
+				m.total[h]++
+				if on {
+					m.hits[h]++
+				}
+			}
+			if on && i < steps {
+				sum += int(trigs[track][i])
+				hit++
+			}
+			h = ((h << 1) | boolBit(on)) & (markovStates - 1)
+		}
+		m.velocity = defaultVelocity
+		if hit > 0 {
+			m.velocity = uint8(sum / hit)
+		}
+		models[track] = m
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// launchpadDevices are the names the ports of the supported grid controllers contain.
+var launchpadDevices = []string{"Launchpad", "APC MINI", "FL STUDIO FIRE", "Ableton Push 2"}
+
+var launchpadPort string // Pattern the Launchpad's JACK ports are matched with. Empty matches any supported controller.
+
+// portMatcher returns a function that reports whether a JACK port name matches a pattern.
+// A pattern in slashes, e.g. /^a2j:.*Launchpad/, is a regular expression,
+// one starting with = is the exact name of a port, e.g. =system:midi_capture_1,
+// and any other pattern matches the port names that contain it.
+// Several patterns can be separated with commas.
+func portMatcher(pattern string) (func(string) bool, error) {
+	var matchers []func(string) bool
+	for _, p := range strings.Split(pattern, ",") {
+		switch {
+		case p == "":
+			return nil, errors.Errorf("empty port pattern in %q", pattern)
+		case len(p) > 1 && strings.HasPrefix(p, "/") && strings.HasSuffix(p, "/"):
+			re, err := regexp.Compile(p[1 : len(p)-1])
+			if err != nil {
+				return nil, errors.Wrapf(err, "compiling port pattern %s", p)
+			}
+			matchers = append(matchers, re.MatchString)
+		case strings.HasPrefix(p, "="):
+			name := p[1:]
+			matchers = append(matchers, func(s string) bool { return s == name })
+		default:
+			matchers = append(matchers, contains(p))
+		}
+	}
+	return func(s string) bool {
+		for _, m := range matchers {
+			if m(s) {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
+
+// setMatchers sets the patterns the Launchpad and Nord Drum ports are connected by,
+// from --launchpad-port and --nd (or the project or device profile).
+func setMatchers() error {
+	launchpadMatches := contains(launchpadDevices...)
+	if launchpadPort != "" {
+		m, err := portMatcher(launchpadPort)
+		if err != nil {
+			return errors.Wrap(err, "launchpad port")
+		}
+		launchpadMatches = m
+	}
+	ndMatches, err := portMatcher(nd)
+	if err != nil {
+		return errors.Wrap(err, "nord drum port")
+	}
+	Ports.Inputs["LaunchpadRecv"].Matches = launchpadMatches
+	Ports.Outputs["LaunchpadSend"].Matches = launchpadMatches
+	Ports.Inputs["NordDrumRecv"].Matches = ndMatches
+	Ports.Outputs["NordDrumSend"].Matches = ndMatches
+	return nil
+}
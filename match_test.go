@@ -0,0 +1,62 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestPortMatcher(t *testing.T) {
+	for _, tc := range []struct {
+		pattern string
+		matches []string
+		misses  []string
+	}{
+		{
+			pattern: "Scarlett",
+			matches: []string{"a2j:Scarlett 6i6 USB [20] (capture): Scarlett 6i6 USB MIDI 1", "Scarlett"},
+			misses:  []string{"a2j:Launchpad Mini [24] (capture): Launchpad Mini MIDI 1", "scarlett"},
+		},
+		{
+			pattern: "/^a2j:.*Launchpad/",
+			matches: []string{"a2j:Launchpad Mini [24] (playback): Launchpad Mini MIDI 1"},
+			misses:  []string{"system:Launchpad", "a2j:Scarlett 6i6 USB"},
+		},
+		{
+			pattern: "=system:midi_capture_1",
+			matches: []string{"system:midi_capture_1"},
+			misses:  []string{"system:midi_capture_10", "a2j:system:midi_capture_1"},
+		},
+		{
+			pattern: "Scarlett,=system:midi_playback_2,/Nord Drum$/",
+			matches: []string{"a2j:Scarlett 6i6 USB", "system:midi_playback_2", "alsa:Nord Drum"},
+			misses:  []string{"system:midi_playback_1", "alsa:Nord Drum 3p"},
+		},
+		{
+			pattern: "/",
+			matches: []string{"a2j:/dev/snd"},
+			misses:  []string{"system:midi_capture_1"},
+		},
+	} {
+		m, err := portMatcher(tc.pattern)
+		if err != nil {
+			t.Fatalf("%q: %s", tc.pattern, err)
+		}
+		for _, name := range tc.matches {
+			if !m(name) {
+				t.Errorf("%q does not match %q", tc.pattern, name)
+			}
+		}
+		for _, name := range tc.misses {
+			if m(name) {
+				t.Errorf("%q matches %q", tc.pattern, name)
+			}
+		}
+	}
+}
+
+func TestPortMatcherErrors(t *testing.T) {
+	for _, pattern := range []string{"", "Scarlett,", ",Launchpad", "/[/"} {
+		if _, err := portMatcher(pattern); err == nil {
+			t.Errorf("%q: expected an error", pattern)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"github.com/pkg/errors"
+)
+
+const (
+	beatsPerBar    = 4   // Number of beats in a bar of the metronome and the count-in.
+	accentVelocity = 127 // Velocity of the click on the first beat of a bar.
+	clickTrack     = -2  // Track of queued clicks, so they can be sent to their own port.
+)
+
+var (
+	metronome    bool  // Flag telling us if the metronome clicks on every beat.
+	clickChannel int   // MIDI channel of the click, from 1 to 16.
+	clickNote    int   // Note of the click.
+	splitClick   bool  // Flag telling us if the click has its own output port.
+	clickOutput  *Port // JACK port for sending the click, when split.
+	clickBuffer  MidiBuffer
+)
+
+// addClickPort adds an output port for the click when it is split.
+// The port is not connected automatically; route it in the JACK graph.
+func addClickPort() {
+	if splitClick {
+		Ports.Outputs["ClickSend"] = &Port{Matches: none}
+	}
+}
+
+// clearClickBuffer gets the buffer of the click port for the current period.
+func clearClickBuffer(nframes uint32) {
+	if splitClick {
+		clickBuffer = backend.Buffer(clickOutput, nframes)
+	}
+}
+
+// click plays the click at an offset from the start of the current period.
+func click(offset, nframes uint32, accent bool) {
+	var (
+		channel  = byte(clickChannel-1) & 0x0F
+		note     = byte(clickNote)
+		velocity = byte(defaultVelocity)
+	)
+	if accent {
+		velocity = accentVelocity
+	}
+	later(clickTrack, offset, nframes, 0x90|channel, note, velocity)
+	later(clickTrack, offset+(samplesPerStep()*defaultGate)/100, nframes, 0x80|channel, note, 0)
+}
+
+// setClickOutput looks up the registered click port.
+func setClickOutput() {
+	if splitClick {
+		clickOutput = Ports.Outputs["ClickSend"]
+	}
+}
+
+// setMetronome turns the metronome on (non-zero) or off (zero).
+func setMetronome(on int) error {
+	metronome = on != 0
+	return nil
+}
+
+// tickMetronome clicks if the metronome is on and a step starts a beat, counting beats from the start of the loop.
+// The first beat of every bar is accented. The count-in clicks on its own, so the metronome is quiet during it.
+func tickMetronome(start, nframes uint32) {
+	if !metronome || countInSteps > 0 {
+		return
+	}
+	n := int64(beat - loopFirst())
+	if n%stepsPerBeat != 0 {
+		return
+	}
+	click(start, nframes, n%(beatsPerBar*stepsPerBeat) == 0)
+}
+
+// toggleMetronome turns the metronome on or off.
+func toggleMetronome() {
+	metronome = !metronome
+}
+
+// validateClick checks the click flags.
+func validateClick() error {
+	if clickChannel < 1 || clickChannel > 16 {
+		return errors.Errorf("click channel must be from 1 to 16, got %d", clickChannel)
+	}
+	if clickNote < 0 || clickNote > 127 {
+		return errors.Errorf("click note must be from 0 to 127, got %d", clickNote)
+	}
+	return nil
+}
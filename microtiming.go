@@ -0,0 +1,53 @@
+package main
+
+const (
+	ticksPerStep = 24 // Resolution of micro-timing offsets. A step can be nudged by half this either way.
+)
+
+// microTimingCycle is the order offsets are cycled through on the grid, in ticks.
+var microTimingCycle = [...]int8{0, 3, 6, -6, -3}
+
+// cycleMicroTiming moves a trig to the next offset of microTimingCycle.
+// Offsets that are not in the cycle, set from a project file, start over at zero.
+func cycleMicroTiming(track, step int) {
+	t := &bank[slot].MicroTiming[track][step]
+
+	for i, offset := range microTimingCycle {
+		if offset == *t {
+			*t = microTimingCycle[(i+1)%len(microTimingCycle)]
+			return
+		}
+	}
+	*t = 0
+}
+
+// microTiming returns the number of samples a trig is nudged by,
+// given the length of the track's steps in samples.
+// Negative offsets play the trig early.
+func microTiming(track, step int, length uint32) int64 {
+	t := int64(bank[slot].MicroTiming[track][step])
+
+	switch {
+	case t > ticksPerStep/2:
+		t = ticksPerStep / 2
+	case t < -ticksPerStep/2:
+		t = -ticksPerStep / 2
+	}
+	return (t * int64(length)) / ticksPerStep
+}
+
+// microTimingColor returns the green and red brightness used to show a trig's offset on the grid.
+// Late trigs are red and early trigs are yellow, brighter the further they are nudged.
+func microTimingColor(track, step int) (g, r int) {
+	switch t := bank[slot].MicroTiming[track][step]; {
+	case t > 3:
+		return 0, 3
+	case t > 0:
+		return 0, 1
+	case t < -3:
+		return 3, 3
+	case t < 0:
+		return 1, 1
+	}
+	return 3, 0
+}
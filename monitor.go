@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+const monitorBytes = 8 // Number of bytes of each message the monitor shows. Longer sysex messages are cut short.
+
+// monitoredEvent is a MIDI message received or sent, on its way from the process callback to printMonitor.
+type monitoredEvent struct {
+	at   uint64 // Frame time of the message.
+	port *Port
+	out  bool // Flag telling us if the message was sent rather than received.
+	size int  // Full size of the message.
+	data [monitorBytes]byte
+}
+
+var (
+	monitoring bool // Flag telling us if the MIDI messages received and sent are printed.
+
+	// monitorEvents hands the messages to printMonitor, which prints them outside of the process callback.
+	monitorEvents = make(chan monitoredEvent, 1024)
+
+	// monitorDropped is the number of messages dropped because printMonitor fell behind. Accessed atomically.
+	monitorDropped uint64
+)
+
+// monitorBackend passes the messages read and written through another backend to the monitor while monitoring is on.
+type monitorBackend struct {
+	Backend
+}
+
+func (b monitorBackend) Events(p *Port, nframes uint32) []*MidiEvent {
+	events := b.Backend.Events(p, nframes)
+	if monitoring {
+		for _, e := range events {
+			monitorEvent(p, e, false)
+		}
+	}
+	return events
+}
+
+func (b monitorBackend) Write(p *Port, event *MidiEvent, buffer MidiBuffer) int {
+	code := b.Backend.Write(p, event, buffer)
+	if monitoring && !isFailure(code) {
+		monitorEvent(p, event, true)
+	}
+	return code
+}
+
+// monitorEvent hands a message to printMonitor, or drops it if printMonitor has fallen behind.
+// It is called from the process callback, so it must not block.
+func monitorEvent(p *Port, e *MidiEvent, out bool) {
+	m := monitoredEvent{at: frameCount + uint64(e.Time), port: p, out: out, size: len(e.Buffer)}
+	copy(m.data[:], e.Buffer)
+	select {
+	case monitorEvents <- m:
+	default:
+		atomic.AddUint64(&monitorDropped, 1)
+	}
+}
+
+// setMonitor turns the monitor on (non-zero) or off (zero).
+func setMonitor(on int) error {
+	monitoring = on != 0
+	return nil
+}
+
+// printMonitor prints the monitored messages, with the time since ndseq started,
+// the port, the direction and the meaning of each.
+func printMonitor() {
+	var dropped uint64
+
+	for m := range monitorEvents {
+		if n := atomic.LoadUint64(&monitorDropped); n != dropped {
+			fmt.Printf("monitor: %d messages dropped\n", n-dropped)
+			dropped = n
+		}
+		var (
+			dir  = "<-"
+			name = "?"
+			at   float64
+		)
+		if m.out {
+			dir = "->"
+		}
+		if m.port != nil && m.port.name != "" {
+			name = m.port.name
+		}
+		if sampleRate > 0 {
+			at = float64(m.at) / float64(sampleRate)
+		}
+		data := m.data[:m.size]
+		if m.size > monitorBytes {
+			data = m.data[:]
+		}
+		meaning := decodeMIDI(data, m.size)
+		if m.port != nil && m.port.Type == umpPortType {
+			meaning = "MIDI 2.0 packet"
+		}
+		fmt.Printf("%12.6f %-15s %s % X  %s\n", at, name, dir, data, meaning)
+	}
+}
+
+// decodeMIDI returns the meaning of a MIDI message of size bytes, of which data is the start.
+func decodeMIDI(data []byte, size int) string {
+	if len(data) == 0 {
+		return "empty"
+	}
+	var (
+		status  = data[0]
+		channel = int(status&0x0F) + 1
+		arg     = func(i int) int {
+			if i < len(data) {
+				return int(data[i])
+			}
+			return 0
+		}
+	)
+	switch status & 0xF0 {
+	case 0x80:
+		return fmt.Sprintf("note off    ch %2d %s velocity %d", channel, noteLabel(arg(1)), arg(2))
+	case 0x90:
+		if arg(2) == 0 {
+			return fmt.Sprintf("note off    ch %2d %s", channel, noteLabel(arg(1)))
+		}
+		return fmt.Sprintf("note on     ch %2d %s velocity %d", channel, noteLabel(arg(1)), arg(2))
+	case 0xA0:
+		return fmt.Sprintf("aftertouch  ch %2d %s pressure %d", channel, noteLabel(arg(1)), arg(2))
+	case 0xB0:
+		return fmt.Sprintf("cc          ch %2d %d = %d", channel, arg(1), arg(2))
+	case 0xC0:
+		return fmt.Sprintf("program     ch %2d %d", channel, arg(1)+1)
+	case 0xD0:
+		return fmt.Sprintf("pressure    ch %2d %d", channel, arg(1))
+	case 0xE0:
+		return fmt.Sprintf("pitch bend  ch %2d %d", channel, (arg(2)<<7|arg(1))-8192)
+	}
+	switch status {
+	case 0xF0:
+		return fmt.Sprintf("sysex, %d bytes", size)
+	case 0xF2:
+		return fmt.Sprintf("song position %d", arg(2)<<7|arg(1))
+	case midiClock:
+		return "clock"
+	case midiStart:
+		return "start"
+	case 0xFB:
+		return "continue"
+	case midiStop:
+		return "stop"
+	case 0xFE:
+		return "active sensing"
+	case 0xFF:
+		return "reset"
+	}
+	if status < 0x80 {
+		return "data without status"
+	}
+	return fmt.Sprintf("system %02X", status)
+}
+
+// noteLabel returns a note number with its name, e.g. 60 (C4).
+func noteLabel(note int) string {
+	return fmt.Sprintf("%3d (%s%d)", note, pitchClasses[note%12], (note/12)-1)
+}
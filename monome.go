@@ -0,0 +1,216 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	monomePrefix = "/ndseq" // OSC address prefix of the messages between ndseq and the grid.
+	monomeTop    = 15       // Column of a 16-column grid whose keys take the place of the top-row buttons, from the top.
+	monomeLevels = 15       // Brightest LED level of a varibright grid.
+)
+
+var (
+	serialoscAddr string // Address serialosc listens on.
+
+	monomeKeys = make(chan [3]int32, 256)  // Presses (1) and releases (0) of the grid's keys: column, row and state.
+	monomeLEDs = make(chan [3]int32, 1024) // LED levels set by the process callback: column, row and level.
+)
+
+// serveMonome asks serialosc for the monome grids it knows about and plays on the first one,
+// or the first one plugged in later. A grid that is unplugged is replaced by the next one plugged in. The grid's keys are handed to the process callback
+// through monomeKeys and its LEDs are set from monomeLEDs (see monomeGrid).
+// It does nothing unless the monome grid is the grid controller.
+func serveMonome() error {
+	if _, ok := grid.(monomeGrid); !ok {
+		return nil
+	}
+	server, err := net.ResolveUDPAddr("udp", serialoscAddr)
+	if err != nil {
+		return errors.Wrap(err, "resolving serialosc address")
+	}
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		return errors.Wrap(err, "listening for serialosc")
+	}
+	port := int32(conn.LocalAddr().(*net.UDPAddr).Port)
+
+	for _, address := range []string{"/serialosc/list", "/serialosc/notify"} {
+		if _, err := conn.WriteToUDP(encodeOSC(address, "127.0.0.1", port), server); err != nil {
+			return errors.Wrap(err, "asking serialosc for grids")
+		}
+	}
+	devices := make(chan *net.UDPAddr, 1)
+	go writeMonome(conn, devices)
+
+	var (
+		buf    = make([]byte, 1024)
+		device *net.UDPAddr
+	)
+	for {
+		n, _, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			return errors.Wrap(err, "reading from serialosc")
+		}
+		m, err := decodeOSC(buf[:n])
+		if err != nil {
+			continue
+		}
+		switch m.Address {
+		case "/serialosc/device", "/serialosc/add":
+			if m.Address == "/serialosc/add" {
+				// Notifications have to be asked for again after each one.
+				_, _ = conn.WriteToUDP(encodeOSC("/serialosc/notify", "127.0.0.1", port), server)
+			}
+			if device != nil || len(m.Args) != 3 {
+				continue
+			}
+			p, ok := m.Args[2].(int32)
+			if !ok {
+				continue
+			}
+			device = &net.UDPAddr{IP: server.IP, Port: int(p)}
+			if err := connectMonome(conn, device, port); err != nil {
+				fmt.Fprintf(os.Stderr, "connecting to monome grid: %s\n", err)
+				device = nil
+				continue
+			}
+			devices <- device
+			commands <- func() { gridPainted = false }
+		case "/serialosc/remove":
+			_, _ = conn.WriteToUDP(encodeOSC("/serialosc/notify", "127.0.0.1", port), server)
+
+			// Forget the grid when it is unplugged, so that it is played on again when it comes back.
+			if device == nil || len(m.Args) != 3 {
+				continue
+			}
+			if p, ok := m.Args[2].(int32); ok && int(p) == device.Port {
+				device = nil
+				devices <- nil
+			}
+		case monomePrefix + "/grid/key":
+			if v, ok := m.ints(3); ok {
+				select {
+				case monomeKeys <- [3]int32{v[0], v[1], v[2]}:
+				default: // Dropped if the process callback falls behind.
+				}
+			}
+		}
+	}
+}
+
+// connectMonome tells a grid to send its keys to ndseq's port with ndseq's prefix, and turns its LEDs off.
+func connectMonome(conn *net.UDPConn, device *net.UDPAddr, port int32) error {
+	for _, m := range [][]byte{
+		encodeOSC("/sys/port", port),
+		encodeOSC("/sys/host", "127.0.0.1"),
+		encodeOSC("/sys/prefix", monomePrefix),
+		encodeOSC(monomePrefix+"/grid/led/level/all", int32(0)),
+	} {
+		if _, err := conn.WriteToUDP(m, device); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeMonome sends the LED levels set by the process callback to the grid, once there is one.
+func writeMonome(conn *net.UDPConn, devices <-chan *net.UDPAddr) {
+	var device *net.UDPAddr
+
+	for {
+		select {
+		case device = <-devices:
+		case l := <-monomeLEDs:
+			if device != nil {
+				_, _ = conn.WriteToUDP(encodeOSC(monomePrefix+"/grid/led/level/set", l[0], l[1], l[2]), device)
+			}
+		}
+	}
+}
+
+// monomeGrid is a monome grid reached through serialosc.
+// Its left 8 columns are the pads and the ninth the side buttons; on a 16-column grid the last
+// column is the top buttons, from the top.
+type monomeGrid struct{}
+
+// Start does nothing: serveMonome sets the grid up.
+func (monomeGrid) Start(ledBuffer MidiBuffer) int {
+	return 0
+}
+
+// Stop turns the LEDs off.
+func (monomeGrid) Stop(ledBuffer MidiBuffer) int {
+	for x := 0; x <= monomeTop; x++ {
+		for y := 0; y < gridSize; y++ {
+			lightMonome(x, y, 0, 0)
+		}
+	}
+	return 0
+}
+
+// Events turns the keys pressed and released on the grid since the last cycle into grid events.
+func (monomeGrid) Events(nframes uint32, events []GridEvent) []GridEvent {
+	for len(events) < cap(events) {
+		var k [3]int32
+
+		select {
+		case k = <-monomeKeys:
+		default:
+			return events
+		}
+		x, y, pressed := int(k[0]), int(k[1]), k[2] != 0
+		switch {
+		case y < 0 || y >= gridSize:
+		case x >= 0 && x < sideColumn:
+			events = append(events, GridEvent{Kind: GridPad, X: x, Y: y, Pressed: pressed})
+		case x == sideColumn:
+			events = append(events, GridEvent{Kind: GridSide, Y: y, Pressed: pressed})
+		case x == monomeTop:
+			events = append(events, GridEvent{Kind: GridTop, X: y, Pressed: pressed})
+		}
+	}
+	return events
+}
+
+// Light sets the LED of a key to a level for a green and red brightness.
+func (monomeGrid) Light(x, y, g, r int, ledBuffer MidiBuffer) int {
+	lightMonome(x, y, g, r)
+	return 0
+}
+
+// LightTop sets the LED of a key in the last column.
+func (monomeGrid) LightTop(i, g, r int, ledBuffer MidiBuffer) int {
+	lightMonome(monomeTop, i, g, r)
+	return 0
+}
+
+// Encoders returns 0: grids have none.
+func (monomeGrid) Encoders() int {
+	return 0
+}
+
+// BeginPaint does nothing: LED levels are sent by serveMonome.
+func (monomeGrid) BeginPaint() {}
+
+// EndPaint does nothing.
+func (monomeGrid) EndPaint(ledBuffer MidiBuffer) int {
+	return 0
+}
+
+// lightMonome sets the LED of a key to a level for a green and red brightness: green is brighter than red.
+// Levels that don't fit in monomeLEDs are dropped.
+func lightMonome(x, y, g, r int) {
+	level := (5 * (g & 3)) + (3 * (r & 3))
+	if level > monomeLevels {
+		level = monomeLevels
+	}
+	select {
+	case monomeLEDs <- [3]int32{int32(x), int32(y), int32(level)}:
+	default:
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+var (
+	muted  [8]bool // Flags telling us which tracks are muted.
+	soloed [8]bool // Flags telling us which tracks are soloed.
+)
+
+// audible reports whether a track's trigs are played.
+// If any track is soloed, only soloed tracks are audible.
+func audible(track int) bool {
+	if track < 0 || track >= len(muted) {
+		return true
+	}
+	for _, s := range soloed {
+		if s {
+			return soloed[track]
+		}
+	}
+	return !muted[track]
+}
+
+// lightSide sets the color of a track's side button:
+// amber when soloed or waiting for a note in learn mode, red when muted, and green otherwise.
+func lightSide(track int, ledBuffer MidiBuffer) int {
+	switch {
+	case soloed[track], track == learnTrack:
+		return light(sideColumn, track, 3, 3, ledBuffer)
+	case muted[track]:
+		return light(sideColumn, track, 0, 3, ledBuffer)
+	}
+	return light(sideColumn, track, 3, 0, ledBuffer)
+}
+
+// paintSides lights every side button to show the mute and solo state.
+func paintSides(ledBuffer MidiBuffer) int {
+	for track := range muted {
+		if code := lightSide(track, ledBuffer); isFailure(code) {
+			return code
+		}
+	}
+	return 0
+}
+
+// toggleMute mutes or unmutes a track.
+func toggleMute(track int, ledBuffer MidiBuffer) int {
+	muted[track] = !muted[track]
+	return lightSide(track, ledBuffer)
+}
+
+// toggleSolo solos or unsolos a track.
+func toggleSolo(track int, ledBuffer MidiBuffer) int {
+	soloed[track] = !soloed[track]
+	return lightSide(track, ledBuffer)
+}
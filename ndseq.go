@@ -7,166 +7,604 @@ import (
 	"os/signal"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/briansorahan/death"
 	"github.com/pkg/errors"
 	flag "github.com/spf13/pflag"
-	"github.com/xthexder/go-jack"
 )
 
 const (
-	clientName = "ndseq" // JACK client name.
+	defaultVelocity = 100  // Velocity of trigs programmed from the Launchpad.
+	gridSize        = 8    // Width and height of the Launchpad grid.
+	maxSteps        = 64   // Maximum pattern length.
+	ndNote          = 0x36 // Default note of every track, which the Nord Drum 3p responds to on every channel.
+
+	defaultND = "Scarlett" // I use a Focusrite Scarlett 6i6 to communicate with the Nord Drum.
 )
 
-// Error codes.
+// Error codes returned by the process callback and the functions it calls. Zero means success.
 const (
+	Failure      = 1 // The backend failed.
 	DivideByZero = 50
 )
 
 var (
-	bufferSize uint32
+	bufferSize uint32 // Frames per period, kept up to date by the buffer size callback.
+	frameCount uint64 // Number of frames processed since the client was activated.
+	sampleRate uint32
+
+	clientName = "ndseq" // JACK client name, and the start of the librarian's.
+	serverName string    // Name of the JACK server to connect to. Empty means the default server.
+
+	// commands are run at the start of the process callback.
+	// Other goroutines use them to read or modify sequencer state without racing with playback.
+	commands = make(chan func(), 16)
+
+	loadPath string // Project file to load at startup.
+	savePath string // Project file to save to on SIGUSR1 and at exit.
+
+	launchpadInput  *Port // JACK port for receiving MIDI data from the Launchpad.
+	launchpadOutput *Port // JACK port for sending MIDI data to the Launchpad.
+
+	nd       string // Pattern the JACK ports of the MIDI interface the Nord Drum 3p is on are matched with (see portMatcher).
+	ndInput  *Port  // JACK port for receiving MIDI data from the Nord Drum 3p.
+	ndOutput *Port  // JACK port for sending MIDI data to the Nord Drum 3p.
+
+	beat            int     // Current step index, always less than steps.
+	chaseStep       = -1    // Step the chase light is on: the last one played, or -1.
+	chaseCued       bool    // Flag telling us if the chase light is waiting on the first step for the transport.
+	steps           int     // Pattern length in steps.
+	firstNotePlayed bool    // Flag telling us if we've ever played a note.
+	gridPainted     bool    // Flag telling us if the Launchpad grid shows the current pattern.
+	exiting         bool    // Flag telling us if ndseq is exiting, after which nothing more is played.
+	page            int     // Index of the 8-step page shown on the Launchpad grid.
+	samplesPerBeat  uint32  // Samples per beat. Gets updated if the sample rate or the tempo changes.
+	tempo           float64 // Tempo in BPM.
+
+	trigs = &bank[0].Trigs // Trigs of the playing pattern.
+)
 
-	client *jack.Client
+func main() {
+	// Run a subcommand if one was named.
+	if ok, err := runSubcommand(os.Args[1:]); ok {
+		death.Main(err)
+		return
+	}
 
-	launchpadInput  *jack.Port // JACK port for sending MIDI data to the Launchpad.
-	launchpadOutput *jack.Port // JACK port for receiving MIDI data from the Launchpad.
+	// Parse the command line flags.
+	flag.StringVar(&nd, "nd", defaultND, ndUsage)
+	flag.Float64Var(&tempo, "t", 120, "Tempo in BPM, e.g. 127.5.")
+	flag.IntVar(&steps, "l", maxSteps, "Pattern length in steps (1-64).")
+	flag.StringVar(&resolution, "resolution", "1/4", "Note value of a step: 1/4, 1/8, 1/16 or 1/32.")
+	flag.StringVar(&loadPath, "load", "", "Project file to load at startup.")
+	flag.StringVar(&savePath, "save", "", "Project file to save to on SIGUSR1 and at exit.")
+	flag.StringVar(&connectionsPath, "connections", "", "File the JACK connections are restored from at startup and saved to on SIGUSR1 and at exit.")
+	flag.BoolVar(&songMode, "song", false, "Play the song stored in the loaded project.")
+	flag.BoolVar(&clockOut, "clock", true, "Send MIDI clock, start and stop to the Nord Drum.")
+	flag.StringVar(&syncMode, "sync", syncInternal, "Clock source: internal, external (MIDI clock on the ClockRecv port) or transport (JACK transport).")
+	flag.BoolVar(&timebase, "timebase", false, "Become JACK timebase master, publishing the bar, beat and tick of the internal clock.")
+	flag.IntVar(&swing, "swing", 0, "Swing amount in percent (0-100).")
+	flag.IntVar(&variation, "variation", 0, "Percentage of steps generated from a Markov model of the pattern (0-100).")
+	flag.StringVar(&caRule, "automaton", "", "Cellular automaton that evolves the pattern each loop: life or a rule number (0-255).")
+	flag.Int64Var(&caSeed, "automaton-seed", 0, "Seed for a random starting grid. 0 starts from the programmed pattern.")
+	flag.StringVar(&scaleName, "scale", chromatic, "Scale notes are quantized to, e.g. major, minor or pentatonic.")
+	flag.StringVar(&rootName, "root", "C", "Root note of the scale, e.g. C, F# or Bb.")
+	flag.StringVar(&profilePath, "profile", "", profileUsage)
+	flag.BoolVar(&splitTracks, "split-tracks", false, "Send each track to its own output port, Track1Send to Track8Send.")
+	flag.IntVar(&programChannel, "program-channel", 1, "MIDI channel the program changes of patterns are sent on (1-16).")
+	flag.StringVar(&kitName, "kit", "", "Built-in kit the tracks play, e.g. nd3p or gm (see ndseq kits).")
+	flag.StringVar(&learnPath, "learn", "", "Learn the channel and note of each track from the Nord Drum's pads and write them to a track config file.")
+	flag.StringVar(&trackPath, "tracks", "", "JSON file with the MIDI channel, note and velocity scale of each track.")
+	flag.IntVar(&baseChannel, "channel", 1, "MIDI channel of the first track when --tracks is not given (1-9).")
+	flag.StringVar(&grooveDir, "grooves", "", "Directory of groove template files.")
+	flag.IntVar(&tempoCC, "tempo-cc", -1, "CC received on the NordDrumRecv port that sets the tempo from 20 (0) to 300 (127) BPM.")
+	flag.IntVar(&tapNote, "tap-note", -1, "Note received on the NordDrumRecv port that taps the tempo.")
+	flag.IntVar(&accentAmount, "accent", 20, "Velocity added to the trigs of accented steps.")
+	flag.IntVar(&humanizeDepth, "humanize", 100, "Percentage the humanize settings of the tracks are scaled by.")
+	flag.IntVar(&nudgeMillis, "nudge", 5, "Milliseconds the nudge pads move the playhead by.")
+	flag.IntVar(&lookahead, "lookahead", 0, "Milliseconds ahead of playback that steps are decided.")
+	flag.BoolVar(&recording, "record", false, "Record notes received on the RecordRecv port from the start.")
+	flag.IntVar(&countInBars, "count-in", 0, "Bars counted in before recording starts (0, 1 or 2).")
+	flag.StringVar(&keyboardPort, "keyboard", "", "JACK ports of a MIDI keyboard whose notes are played on the Nord Drum, like --nd.")
+	flag.IntVar(&keyboardChannel, "keyboard-channel", 0, "Nord Drum channel the keyboard plays (1-16). 0 plays the focus track's channel.")
+	flag.BoolVar(&metronome, "metronome", false, "Click on every beat.")
+	flag.IntVar(&clickChannel, "click-channel", 10, "MIDI channel of the metronome and count-in click (1-16).")
+	flag.IntVar(&clickNote, "click-note", 37, "Note of the metronome and count-in click.")
+	flag.BoolVar(&splitClick, "click-port", false, "Send the click to its own ClickSend port.")
+	flag.StringVar(&launchpadName, "launchpad", "auto", "Launchpad model: auto, original, s, mini, mk2, pro, mini-mk3, x, pro-mk3, apc-mini, fire, push2 or monome.")
+	flag.StringVar(&launchpadPort, "launchpad-port", "", "JACK ports of the Launchpad, like --nd. By default any supported controller's.")
+	flag.StringVar(&launchpadFilter, "launchpad-filter", "", "Messages from the Launchpad dropped before they are handled, e.g. -aftertouch,-sensing.")
+	flag.StringVar(&ndFilter, "nd-filter", "", "Messages from the Nord Drum dropped before they are handled, e.g. -sensing,channels=1-8,notes=36-51.")
+	flag.StringVar(&serialoscAddr, "serialosc", "127.0.0.1:12002", "Address of serialosc, for --launchpad monome.")
+	flag.IntVar(&faderCC, "fader-cc", -1, "Nord Drum CC the APC Mini's faders send on their track's channel, instead of scaling the track velocities.")
+	flag.StringVar(&launchpad2Name, "launchpad2", "", "Model of a second Launchpad, or auto to detect it.")
+	flag.StringVar(&launchpad2Role, "launchpad2-role", roleSpan, "What the second Launchpad is for: span (the next page) or perform (performance controls).")
+	flag.StringVar(&themeName, "theme", themeName, "Colors the grid shows steps in: classic, rainbow or pairs.")
+	flag.BoolVar(&follow, "follow", false, "Show the page of steps the playhead is on.")
+	flag.BoolVar(&aftertouch, "aftertouch", false, "Raise the velocity of a held step by pressing harder, on velocity-sensitive Launchpads.")
+	flag.BoolVar(&paletteLEDs, "palette-leds", false, "Light RGB Launchpads from their color palette instead of with RGB sysex.")
+	flag.IntVar(&xrunThreshold, "xrun-warn", 0, "Warn when there are more than this many xruns in a minute. Zero disables the warning.")
+	flag.StringVar(&backendName, "backend", backendJACK, backendUsage)
+	flag.StringVar(&clientName, "client-name", clientName, clientNameUsage)
+	flag.StringVar(&serverName, "server", "", serverUsage)
+	flag.BoolVar(&umpOut, "ump", false, "Send the tracks with ump set in their track config as MIDI 2.0 packets on the UMPSend port.")
+	flag.StringVar(&rtpListen, "rtp-midi-listen", "", "Address to accept RTP-MIDI sessions on, e.g. :5004.")
+	flag.StringVar(&rtpInvite, "rtp-midi", "", "Address of an RTP-MIDI device or app to start a session with, e.g. 192.168.1.20:5004.")
+	flag.BoolVar(&monitoring, "monitor", false, "Print every MIDI message received and sent, with its time and meaning.")
+	flag.StringVar(&controlAddr, "control", "", "Address for the HTTP control API, e.g. localhost:8123.")
+	flag.Usage = usage
+	flag.Parse()
 
-	nd       string     // Name of the MIDI interface to use for communicating with the Nord Drum 3p.
-	ndInput  *jack.Port // JACK port for sending MIDI data to the Nord Drum 3p.
-	ndOutput *jack.Port // JACK port for receiving MIDI data from the Nord Drum 3p.
+	death.Main(validateSync())
+	death.Main(validateTimebase())
+	death.Main(joinSession())
+	if _, ok := resolutions[resolution]; !ok {
+		death.Main(errors.New("resolution must be 1/4, 1/8, 1/16 or 1/32"))
+	}
 
-	beat            int    // 64 steps
-	firstNotePlayed bool   // Flag telling us if we've ever played a note.
-	sampleCount     uint32 // Current sample count. This gets reset everytime we trigger a sequencer step.
-	samplesPerBeat  uint32 // Samples per beat. Gets updated if the sample rate or the tempo changes.
-	tempo           uint32 // Tempo in BPM.
+	if syncMode == syncExternal {
+		Ports.Inputs["ClockRecv"] = &Port{Matches: none}
+	}
+	addTrackPorts()
+	addClickPort()
+	addUMPPort()
+
+	death.Main(errors.Wrap(loadTracks(trackPath), "loading tracks"))
+	death.Main(errors.Wrap(loadProfile(profilePath), "loading profile"))
+	if trackPath != "" {
+		kitName = "" // The track config file takes precedence.
+	}
+	death.Main(errors.Wrap(setKit(kitName), "loading kit"))
+	death.Main(errors.Wrap(loadGrooves(grooveDir), "loading grooves"))
 
-	trigs [8][64]uint8 // Launchpad grid data.
-)
+	if loadPath != "" {
+		death.Main(errors.Wrap(loadProject(loadPath), "loading project"))
+	}
+	setResolution(bank[slot].Resolution)
+	death.Main(setSwing(swing))
+	death.Main(setVariation(variation))
+	death.Main(setScale(scaleName, rootName))
+	death.Main(seedAutomaton())
+	seedRand(uint32(time.Now().UnixNano()))
+	trainModels()
+	if songMode {
+		death.Main(errors.Wrap(startSong(), "starting song"))
+	}
 
-func main() {
-	// Parse the command line flags.
-	// I use a Focusrite Scarlett 6i6 to communicate with the Nord Drum.
-	flag.StringVar(&nd, "nd", "Scarlett", "JACK port for the Nord Drum 3p.")
-	flag.Uint32Var(&tempo, "t", 120, "Tempo in BPM.")
-	flag.Parse()
+	if steps < 1 || steps > maxSteps {
+		death.Main(errors.Errorf("pattern length must be between 1 and %d", maxSteps))
+	}
+	death.Main(validateTempo(tempo))
+	if lookahead < 0 {
+		death.Main(errors.New("lookahead must not be negative"))
+	}
+	death.Main(setLaunchpad(launchpadName))
+	death.Main(setMatchers())
+	death.Main(setFilters())
+	death.Main(setKeyboardPort())
+	death.Main(setKeyboardChannel(keyboardChannel))
+	death.Main(setupGrids())
+	death.Main(setTheme(themeName))
+	death.Main(validateAccent())
+	death.Main(setHumanize(humanizeDepth))
+	death.Main(validateCountIn())
+	death.Main(validateClick())
+	death.Main(validateFaderCC())
+	death.Main(validateXrunThreshold())
+	death.Main(validateBackend())
+	useBackend()
+	death.Main(useServer())
+	if programChannel < 1 || programChannel > 16 {
+		death.Main(errors.Errorf("program channel must be from 1 to 16, got %d", programChannel))
+	}
+	startLearning()
+	if recording && countInBars > 0 {
+		recording = false
+		armRecording()
+	}
 
-	var code int
+	// Open the ports and start playing.
+	death.Main(openClient(Process))
+
+	// Connect the devices plugged in from now on.
+	go connectRegistered()
 
-	// Open the JACK client.
-	client, code = jack.ClientOpen(clientName, jack.NoStartServer)
-	death.Main(wrapCode(code, "opening JACK client"))
+	// Save when the session manager saves the session.
+	go func() {
+		death.Main(serveSession())
+	}()
 
-	// Set the callbacks.
-	death.Main(wrapCode(client.SetSampleRateCallback(setSamplesPerBeat), "setting sample rate callback"))
-	death.Main(wrapCode(client.SetProcessCallback(Process), "setting process callback"))
+	// Play tracks on network MIDI devices.
+	go func() {
+		death.Main(serveRTPMIDI())
+	}()
 
-	// Register the JACK ports.
-	death.Main(errors.Wrap(registerPorts(), "registering ports"))
+	// Print the MIDI messages while the monitor is on.
+	go printMonitor()
 
-	// Activate the client.
-	death.Main(wrapCode(client.Activate(), "activating JACK client"))
+	// Report xruns.
+	go watchXruns()
 
-	// Set the buffer size.
-	bufferSize = client.GetBufferSize()
+	// Serve the control API.
+	go func() {
+		death.Main(serveControl())
+	}()
+
+	// Play on a monome grid.
+	go func() {
+		death.Main(serveMonome())
+	}()
 
 	// Wait for a signal or context done.
 	var (
 		ctx = context.Background()
 		sc  = make(chan os.Signal, 1)
+
+		// The JACK client is reopened in a goroutine while the server is away (see reopenClient).
+		reconnecting  bool
+		stopReconnect chan struct{}
+		reconnected   = make(chan bool, 1)
 	)
-	signal.Notify(sc, os.Interrupt, syscall.SIGQUIT, syscall.SIGINT)
+	signal.Notify(sc, os.Interrupt, syscall.SIGQUIT, syscall.SIGINT, syscall.SIGTERM, syscall.SIGUSR1, syscall.SIGUSR2)
+
+	for {
+		serverGone := shutdown
+		if reconnecting {
+			serverGone = nil // A shutdown of the reopened client is handled once it is reported.
+		}
+		select {
+		case <-ctx.Done():
+			os.Exit(0)
+		case <-serverGone:
+			reconnecting, stopReconnect = true, make(chan struct{})
+			go func(stop <-chan struct{}) { reconnected <- reopenClient(stop) }(stopReconnect)
+		case <-reconnected:
+			reconnecting = false
+		case k := <-learned:
+			if err := writeTracks(learnPath, k); err != nil {
+				fmt.Fprintf(os.Stderr, "writing learned tracks: %s\n", err)
+			}
+		case sig := <-sc:
+			if reconnecting && (sig == syscall.SIGUSR1 || sig == syscall.SIGUSR2) {
+				fmt.Fprintf(os.Stderr, "reconnecting to the JACK server, ignoring %s\n", sig)
+				continue
+			}
+			if reconnecting {
+				close(stopReconnect)
+				if reopened := <-reconnected; !reopened {
+					exitDisconnected(sig)
+				}
+				reconnecting = false
+			}
+			if sig == syscall.SIGUSR1 {
+				if err := saveProject(savePath); err != nil {
+					fmt.Fprintf(os.Stderr, "saving project: %s\n", err)
+				}
+				if err := saveConnections(connectionsPath); err != nil {
+					fmt.Fprintf(os.Stderr, "saving connections: %s\n", err)
+				}
+				continue
+			}
+			if sig == syscall.SIGUSR2 {
+				runInProcess(midiPanic)
+				continue
+			}
+			fmt.Printf("received %s, exiting\n", sig)
+			stopClock()
+			stopGrid()
+			if !inSession() || sig != syscall.SIGTERM { // The session manager saves before it stops ndseq.
+				death.Main(errors.Wrap(saveProject(savePath), "saving project"))
+				death.Main(errors.Wrap(saveConnections(connectionsPath), "saving connections"))
+			}
+			closeClient()
+			endRTPSessions()
+			os.Exit(0)
+		}
+	}
+}
 
-	select {
-	case <-ctx.Done():
-		os.Exit(0)
-	case sig := <-sc:
-		fmt.Printf("received %s, exiting\n", sig)
-		os.Exit(0)
+// exitDisconnected exits on a signal received while the JACK server is away.
+// No process callback runs then, so the project is saved without going through it,
+// and the connections file is left as it was last saved.
+func exitDisconnected(sig os.Signal) {
+	fmt.Printf("received %s, exiting\n", sig)
+	if savePath != "" && (!inSession() || sig != syscall.SIGTERM) {
+		death.Main(errors.Wrap(writeProject(savePath, currentProject()), "saving project"))
 	}
+	endRTPSessions()
+	os.Exit(0)
 }
 
 // Process is the JACK process callback.
 func Process(nframes uint32) int {
 	var (
-		launchpadEvents = launchpadInput.GetMidiEvents(bufferSize)
-		outBuffer       = ndOutput.MidiClearBuffer(nframes)
+		ledBuffer = clearGridBuffers(nframes)
+		outBuffer = backend.Buffer(ndOutput, nframes)
 	)
-	if len(launchpadEvents) > 0 {
-		for _, event := range launchpadEvents {
-			if code := processMidi(nframes, event, outBuffer); code != 0 {
-				return code
-			}
+	clearTrackBuffers(nframes)
+	clearClickBuffer(nframes)
+	clearUMPBuffer(nframes)
+	runCommands()
+	if exiting {
+		return flushQueue(outBuffer)
+	}
+
+	if code := startGrids(ledBuffer); isFailure(code) {
+		return code
+	}
+	if !gridPainted {
+		if code := paintGrid(ledBuffer); isFailure(code) {
+			return code
+		}
+		gridPainted = true
+	}
+	if code := gridInput(nframes, ledBuffer); isFailure(code) {
+		return code
+	}
+	if code := recordNotes(nframes, ledBuffer); isFailure(code) {
+		return code
+	}
+	keyboardThru(nframes)
+	for _, event := range backend.Events(ndInput, nframes) {
+		tempoControl(event.Buffer)
+		tapControl(event.Buffer, frameCount+uint64(event.Time))
+		if code := learnNote(event.Buffer, ledBuffer); isFailure(code) {
+			return code
 		}
 	}
-	return tick(nframes, outBuffer)
+	var code int
+
+	switch syncMode {
+	case syncExternal:
+		code = followClock(nframes, ledBuffer)
+	case syncTransport:
+		code = followTransport(nframes, ledBuffer)
+	default:
+		applyTempo(int64(frameCount))
+		code = tick(nframes, ledBuffer)
+		clock(nframes, int64(frameCount))
+		runRepeats(nframes, int64(frameCount))
+	}
+	if isFailure(code) {
+		return code
+	}
+	playPending(nframes)
+	runLFOs(nframes)
+	frameCount += uint64(nframes)
+	publishPosition()
+
+	return flushQueue(outBuffer)
 }
 
-func advanceStepLight(outBuffer jack.MidiBuffer) int {
-	if beat == 0 && !firstNotePlayed {
-		// First note ever: light step 0.
-		beat++
-		return launchpadOutput.MidiEventWrite(&jack.MidiData{Buffer: []byte{0x90, 0x10, 63}}, outBuffer)
+// advanceStepLight moves the chase light to the step just played and advances to the next step.
+// The previous step's column gets its colors back and the played step's column is lit.
+func advanceStepLight(ledBuffer MidiBuffer) int {
+	prev := chaseStep
+	chaseStep, chaseCued, beat = beat, false, nextBeat(beat)
+
+	if prev >= 0 && prev != chaseStep {
+		if code := lightColumn(prev, ledBuffer); isFailure(code) {
+			return code
+		}
 	}
-	beat++
-	return 0
+	return lightColumn(chaseStep, ledBuffer)
 }
 
-func cc(nframes uint32, in []byte, outBuffer jack.MidiBuffer) int {
-	var (
-		event = jack.MidiData{
-			Buffer: []byte{0x90, 0x36, in[2]}, // Note On C3
+// cueChase moves the chase light to the first step, flashing until the next step is played.
+func cueChase(ledBuffer MidiBuffer) int {
+	prev := chaseStep
+	chaseStep, chaseCued = 0, true
+
+	if prev > 0 {
+		if code := lightColumn(prev, ledBuffer); isFailure(code) {
+			return code
 		}
-	)
-	// Set the output channel.
-	switch in[1] {
-	case 0x68: // Button 1
-	case 0x69: // Button 2
-		event.Buffer[0] |= 0x01
-	case 0x6A: // Button 3
-		event.Buffer[0] |= 0x02
-	case 0x6B: // Button 4
-		event.Buffer[0] |= 0x03
-	case 0x6C: // Button 5
-		event.Buffer[0] |= 0x04
-	case 0x6D: // Button 6
-		event.Buffer[0] |= 0x05
-	}
-	return ndOutput.MidiEventWrite(&event, outBuffer)
-}
-
-func contains(sub string) func(string) bool {
+	}
+	return lightColumn(chaseStep, ledBuffer)
+}
+
+// lightColumn updates the LEDs of a step on every track.
+func lightColumn(step int, ledBuffer MidiBuffer) int {
+	for track := range trigs {
+		if code := lightStep(track, step, ledBuffer); isFailure(code) {
+			return code
+		}
+	}
+	return 0
+}
+
+func contains(subs ...string) func(string) bool {
 	return func(s string) bool {
-		return strings.Contains(s, sub)
+		for _, sub := range subs {
+			if strings.Contains(s, sub) {
+				return true
+			}
+		}
+		return false
 	}
 }
 
 func isFailure(code int) bool {
-	return code == jack.Failure || code == jack.InvalidOption || code == jack.NameNotUnique ||
-		code == jack.ServerError || code == jack.NoSuchClient || code == jack.LoadFailure ||
-		code == jack.InitFailure || code == jack.ShmFailure || code == jack.VersionError ||
-		code == jack.BackendError || code == jack.ClientZombie || code == DivideByZero
+	return code == Failure || code == DivideByZero
 }
 
-func light(x, y, g, r int, outBuffer jack.MidiBuffer) int {
-	var (
-		note     = byte(x + (16 * y))
-		velocity = byte((16 * g) + r + 8 + 4)
-	)
-	return ndOutput.MidiEventWrite(&jack.MidiData{Buffer: []byte{0x90, note, velocity}}, outBuffer)
+// light sets the color of the grid controllers' LED at column x and row y (see lightGrids).
+// g and r are the green and red brightness, from 0 (off) to 3 (full).
+func light(x, y, g, r int, ledBuffer MidiBuffer) int {
+	return lightGrids(x, y, g, r, ledBuffer)
+}
+
+// lightStep updates the LED for a step if it is on the visible page.
+// Steps that are off are lit in the theme's playhead color while the chase light is on them,
+// flashing while it waits on the first step for the transport to start.
+// In the note and chord views only steps of the focus track are shown,
+// and on parameter pages no steps are, except the focus track's on the pitch page.
+// The step is lit on every controller that shows steps unless the controller being handled or painted does.
+func lightStep(track, step int, ledBuffer MidiBuffer) int {
+	if activeGrid < 0 || !showsSteps(activeGrid) {
+		return eachStepGrid(func() int { return lightStep(track, step, ledBuffer) })
+	}
+	if editing() {
+		if editPage != pitchPage || track != focus {
+			return 0
+		}
+		return lightPitchColumn(step, ledBuffer)
+	}
+	if pianoRoll() {
+		if track != focus {
+			return 0
+		}
+		return lightNoteColumn(step, ledBuffer)
+	}
+	x, y, ok := stepPad(track, step)
+	if !ok {
+		return 0
+	}
+	g, r := stepColor(track, step)
+	if g == 0 && r == 0 && step == chaseStep {
+		g, r = theme.Playhead.G, theme.Playhead.R
+		if chaseCued {
+			g |= flash
+		}
+	}
+	return light(x, y, g, r, ledBuffer)
+}
+
+// none matches no port names, for ports that are only ever connected by hand.
+func none(string) bool {
+	return false
+}
+
+// pad handles grid pad presses and releases.
+// Pads edit the step under them according to the current view.
+// Steps turned on in the steps view get the velocity the pad was struck with.
+func pad(x, y int, pressed bool, velocity uint8, ledBuffer MidiBuffer) int {
+	if repeatPulses > 0 && (!pressed || (heldSlot() < 0 && heldTrack() < 0)) {
+		holdRepeat(y, pressed)
+		return 0
+	}
+	if !pressed {
+		if currentGrid().Encoders() > 0 {
+			return releaseHeldStep(x, y, ledBuffer)
+		}
+		return 0 // Pad release.
+	}
+	if heldSlot() >= 0 {
+		topUsed = true
+		topPad(x, y)
+		return 0
+	}
+	if track := heldTrack(); track >= 0 {
+		trackAction(track, x, y)
+		return 0
+	}
+	if editing() {
+		return setParam(x, y, ledBuffer)
+	}
+	track, step, ok := padStep(x, y)
+	if !ok {
+		return 0
+	}
+	if currentGrid().Encoders() > 0 {
+		return pressHeldStep(track, step, velocity, ledBuffer)
+	}
+	return editStep(track, step, velocity, ledBuffer)
+}
+
+// topPad handles a pad press while a top-row button is held, or on a performance controller.
+// The first row changes the tempo, the next three set the loop, and the last four
+// nudge the playhead or turn the page, set note repeat, record and pick the parameter page.
+func topPad(x, y int) {
+	switch y {
+	case 0:
+		tempoPad(x, frameCount)
+	case 4:
+		nudgePad(x)
+		pagePad(x)
+	case 5:
+		repeatPad(x)
+	case 6:
+		recordPad(x)
+	case 7:
+		editPad(x)
+	default:
+		loopPad(y, (page*gridSize)+x)
+	}
+}
 
+// paintGrid lights the bank slot buttons, the side buttons and every pad of each controller.
+// Controllers that can set several LEDs in one message get the whole grid once it is painted.
+func paintGrid(ledBuffer MidiBuffer) int {
+	for _, c := range grids {
+		c.BeginPaint()
+	}
+	if code := paintControls(ledBuffer); isFailure(code) {
+		return code
+	}
+	for _, c := range grids {
+		if code := c.EndPaint(ledBuffer); isFailure(code) {
+			return code
+		}
+	}
+	return 0
 }
 
-func note(nframes uint32, in []byte, out jack.MidiBuffer) int {
+// paintControls lights the bank slot buttons, the side buttons and every pad of each controller.
+func paintControls(ledBuffer MidiBuffer) int {
+	if code := paintSlots(ledBuffer); isFailure(code) {
+		return code
+	}
+	if code := paintSides(ledBuffer); isFailure(code) {
+		return code
+	}
+	for i := range grids {
+		if code := withGrid(i, func() int { return paintPads(ledBuffer) }); isFailure(code) {
+			return code
+		}
+	}
 	return 0
 }
 
-type Port struct {
-	*jack.Port
+// paintPads lights every pad of the controller being painted: the visible page, the parameter page,
+// or the performance controls.
+func paintPads(ledBuffer MidiBuffer) int {
+	if performing() {
+		return paintPerform(ledBuffer)
+	}
+	if editing() {
+		return paintParams(ledBuffer)
+	}
+	for track := range trigs {
+		for x := 0; x < gridSize; x++ {
+			if code := lightStep(track, (page*gridSize)+x, ledBuffer); isFailure(code) {
+				return code
+			}
+		}
+	}
+	return 0
+}
 
-	Matches    func(string) bool
-	Flags      uint64
-	BufferSize uint64
+// padStep maps the Launchpad grid pad at column x and row y to a track and step.
+// Rows are tracks and columns are the steps of the visible page.
+// ok is false if the pad is not on the grid or the step is beyond the pattern length.
+func padStep(x, y int) (track, step int, ok bool) {
+	if x >= gridSize || y >= gridSize {
+		return 0, 0, false
+	}
+	step = (page * gridSize) + x
+	return y, step, step < steps
+}
+
+type Port struct {
+	Matches func(string) bool
+	Only    int          // If not zero, only the Only-th matching port, from 1, is connected.
+	Type    string       // Port type, for backends with ports other than MIDI ones (see umpPortType). Empty means MIDI.
+	Filter  *InputFilter // Filter of the messages received on an input. Nil lets every message through.
+
+	name   string      // Name of the port, without the client name. Set by Backend.Register.
+	handle interface{} // The backend's port. Set by Backend.Register.
+	parser midiParser  // Parser of the bytes received on an input (see parserBackend).
 }
 
 var Ports = struct {
@@ -175,34 +613,79 @@ var Ports = struct {
 }{
 	Inputs: map[string]*Port{
 		"LaunchpadRecv": {
-			Matches: contains("Launchpad"),
+			Matches: contains(launchpadDevices...),
 		},
 		"NordDrumRecv": {
-			Matches: contains("Scarlett"),
+			Matches: none, // Set from --nd (see setMatchers).
+		},
+		"RecordRecv": {
+			Matches: none,
+		},
+		"KeyboardIn": {
+			Matches: none,
 		},
 	},
 	Outputs: map[string]*Port{
 		"LaunchpadSend": {
-			Matches: contains("Launchpad"),
+			Matches: contains(launchpadDevices...),
 		},
 		"NordDrumSend": {
-			Matches: contains("Scarlett"),
+			Matches: none, // Set from --nd.
 		},
 	},
 }
 
+// registerPorts registers the inputs and outputs with the backend.
 func registerPorts() error {
 	for name, input := range Ports.Inputs {
-		input.Port = client.PortRegister(name, jack.DEFAULT_MIDI_TYPE, input.Flags|jack.PortIsInput, input.BufferSize)
+		if err := backend.Register(name, input, false); err != nil {
+			return err
+		}
 	}
 	for name, output := range Ports.Outputs {
-		output.Port = client.PortRegister(name, jack.DEFAULT_MIDI_TYPE, output.Flags|jack.PortIsOutput, output.BufferSize)
+		if err := backend.Register(name, output, true); err != nil {
+			return err
+		}
+	}
+	launchpadInput = Ports.Inputs["LaunchpadRecv"]
+	launchpadOutput = Ports.Outputs["LaunchpadSend"]
+	launchpad.in, launchpad.out = launchpadInput, launchpadOutput
+	if in, ok := Ports.Inputs["Launchpad2Recv"]; ok {
+		launchpad2.in, launchpad2.out = in, Ports.Outputs["Launchpad2Send"]
+	}
+	ndInput = Ports.Inputs["NordDrumRecv"]
+	recordInput = Ports.Inputs["RecordRecv"]
+	keyboardInput = Ports.Inputs["KeyboardIn"]
+	ndOutput = Ports.Outputs["NordDrumSend"]
+
+	if in, ok := Ports.Inputs["ClockRecv"]; ok {
+		clockInput = in
+	}
+	setTrackOutputs()
+	setClickOutput()
+	setUMPOutput()
+	return nil
+}
+
+// connectPorts connects the outputs and inputs to the ports of other clients they match.
+func connectPorts() error {
+	if err := connectDevices(Ports.Outputs, true, connectOutput); err != nil {
+		return err
 	}
-	for _, in := range client.GetPorts("", jack.DEFAULT_MIDI_TYPE, jack.PortIsInput) {
-		for name, out := range Ports.Outputs {
-			if out.Matches(in) {
-				rc := client.ConnectPorts(out.Port, client.GetPortByName(in))
-				if err := wrapCodef(rc, "connecting %s to %s", name, in); err != nil {
+	return connectDevices(Ports.Inputs, false, connectInput)
+}
+
+// connectDevices connects ndseq's ports to the ports of other clients they match,
+// the outputs to their inputs if inputs is set and the inputs to their outputs if not.
+func connectDevices(ports map[string]*Port, inputs bool, connect func(name string, own *Port, device string) error) error {
+	matched := map[string]int{}
+	for _, device := range backend.Devices(inputs) {
+		for name, p := range ports {
+			if !p.Matches(device) {
+				continue
+			}
+			if matched[name]++; p.Only == 0 || matched[name] == p.Only {
+				if err := connect(name, p, device); err != nil {
 					return err
 				}
 			}
@@ -211,67 +694,194 @@ func registerPorts() error {
 	return nil
 }
 
-func processMidi(nframes uint32, event *jack.MidiData, outBuffer jack.MidiBuffer) int {
-	switch event.Buffer[0] {
-	case 0xB0: // CC
-		return cc(nframes, event.Buffer, outBuffer)
-	case 0x80, 0x90: // Note
-		return note(nframes, event.Buffer, outBuffer)
+// connectOutput connects one of the outputs to the input of another client.
+func connectOutput(name string, out *Port, in string) error {
+	return errors.Wrapf(backend.Connect(out, in), "connecting %s to %s", name, in)
+}
+
+// connectInput connects the output of another client to one of the inputs.
+func connectInput(name string, in *Port, out string) error {
+	return errors.Wrapf(backend.Connect(in, out), "connecting %s to %s", out, name)
+}
+
+// runInProcess runs f inside the process callback and waits for it to return.
+func runInProcess(f func()) {
+	done := make(chan struct{})
+	commands <- func() {
+		f()
+		close(done)
+	}
+	<-done
+}
+
+// closeClient stops playing, sends the scheduled note offs right away (see releaseNotes)
+// and closes the JACK client once the period that sends them has ended.
+func closeClient() {
+	for _, f := range []func(){
+		func() { exiting = true; releaseNotes() },
+		func() {}, // The period that sent the note offs has ended once this runs.
+	} {
+		f := f
+		done := make(chan struct{})
+		commands <- func() { f(); close(done) }
+
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+		}
+	}
+	_ = backend.Close() // Best effort.
+}
+
+// runCommands runs every pending command without blocking.
+func runCommands() {
+	for {
+		select {
+		case cmd := <-commands:
+			cmd()
+		default:
+			return
+		}
 	}
-	return 0
 }
 
 func setSamplesPerBeat(sr uint32) int {
-	if tempo == 0 {
+	sampleRate = sr
+
+	if syncMode == syncExternal {
+		return 0 // The tempo is measured from the incoming clock.
+	}
+	if tempo <= 0 {
 		return DivideByZero
 	}
-	samplesPerBeat = (60 * sr) / tempo
+	samplesPerBeat = uint32((60 * float64(sr)) / tempo)
 	return 0
 }
 
-func stepLightMidiData(beat int) *jack.MidiData {
-	var (
-		note = byte((beat / 8) + (16 * (beat % 8)))
-	)
-	return &jack.MidiData{Buffer: []byte{0x90, note, 63}}
+// stepPad maps a track and step to the Launchpad pad that displays it.
+// ok is false if the step is not on the visible page.
+func stepPad(track, step int) (x, y int, ok bool) {
+	if step >= steps || step/gridSize != page {
+		return 0, 0, false
+	}
+	return step % gridSize, track, true
 }
 
-func tick(nframes uint32, outBuffer jack.MidiBuffer) int {
+// tick advances the sequencer from the internal tempo.
+// Every step that starts before the end of the period plus the lookahead is triggered
+// at its offset from the start of the period, so steps are sample-accurate whatever the buffer size.
+func tick(nframes uint32, ledBuffer MidiBuffer) int {
 	if !firstNotePlayed {
-		if code := advanceStepLight(outBuffer); isFailure(code) {
-			return code
+		anchorTempo(int64(frameCount))
+		anchorSteps()
+	}
+	var (
+		now     = int64(frameCount)
+		horizon = now + int64(nframes) + int64(lookaheadFrames())
+	)
+	for {
+		at := stepFrames(stepCount) + stepDelay(beat) + nudgeOffset
+		if at >= horizon {
+			return 0
+		}
+		if at < now {
+			at = now
 		}
+		stepLen = stepLength(beat)
+		code := trigger(uint32(at-now), nframes, ledBuffer)
 		firstNotePlayed = true
-
-		return trigger(nframes, outBuffer)
-	}
-	if sampleCount+nframes < samplesPerBeat {
-		sampleCount += nframes
-		return 0
+		if isFailure(code) {
+			return code
+		}
+		stepCount++
 	}
-	return trigger(nframes, outBuffer)
 }
 
-func trigger(nframes uint32, outBuffer jack.MidiBuffer) int {
-	for track, trackTrigs := range trigs {
-		for _, trig := range trackTrigs {
-			// TODO: trigger the notes.
-			if code := triggerTrack(track, trig, outBuffer); isFailure(code) {
+// trigger fires the trigs of the current step on every track
+// and then advances to the next step.
+// Each track plays from its own playhead at its own speed, so a master step can hold
+// several steps of a fast track or none of a slow one.
+// Trigs nudged late are scheduled within the current step, and trigs of the next step
+// that are nudged early are scheduled at the end of it.
+// start is the offset of the step in the current period.
+func trigger(start, nframes uint32, ledBuffer MidiBuffer) int {
+	length := stepLen
+
+	sendProgram(start, nframes)
+	tickMetronome(start, nframes)
+	if code := countIn(start, nframes, ledBuffer); isFailure(code) {
+		return code
+	}
+
+	for track := range trigs {
+		first, n, hit, stepSamples := trackHits(track, length)
+
+		for i := 0; i < n; i++ {
+			var (
+				step   = stepAt(track, first+uint64(i))
+				offset = int64(start) + int64(hit+uint32(i)*stepSamples)
+				delay  = microTiming(track, step, stepSamples)
+			)
+			recordHit(track, first+uint64(i), int64(frameCount)+offset, stepSamples)
+			if code := replaceStep(track, step, ledBuffer); isFailure(code) {
 				return code
 			}
+
+			if delay < 0 && firstNotePlayed {
+				continue // Scheduled by the previous step.
+			}
+			if delay < 0 {
+				delay = 0
+			}
+			triggerTrack(track, step, uint32(offset+delay), stepSamples, nframes)
 		}
+		advanceTrack(track)
 	}
-	return 0
-}
-
-func triggerTrack(track int, trig uint8, outBuffer jack.MidiBuffer) int {
-	return 0
-}
-
-func wrapCode(code int, msg string) error {
-	return errors.Wrap(jack.Strerror(code), msg)
+	code := advanceStepLight(ledBuffer)
+	followPlayhead(beat)
+	rampTempo()
+	if beat == loopFirst() {
+		advanceSong()
+		switchSlot()
+		evolve()
+		trainModels()
+	}
+	for track := range trigs {
+		first, n, hit, stepSamples := trackHits(track, length)
+
+		for i := 0; i < n; i++ {
+			var (
+				step   = stepAt(track, first+uint64(i))
+				offset = int64(start) + int64(length) + int64(hit+uint32(i)*stepSamples)
+			)
+			if delay := microTiming(track, step, stepSamples); delay < 0 {
+				triggerTrack(track, step, uint32(offset+delay), stepSamples, nframes)
+			}
+		}
+	}
+	return code
 }
 
-func wrapCodef(code int, format string, args ...interface{}) error {
-	return errors.Wrapf(jack.Strerror(code), format, args...)
+// triggerTrack schedules a note on to the Nord Drum for a single trig, along with its
+// parameter locks and ratchets.
+// offset is the time of the note from the start of the current period
+// and length is the duration of the track's step in samples.
+// Each track plays on its own MIDI channel and the trig value is used as the velocity.
+func triggerTrack(track, step int, offset, length, nframes uint32) {
+	trig := fillTrig(track, step)
+	if trig == 0 || !audible(track) || !bank[slot].Conditions[track][step].fires() || !chance(uint8(probability(track, step))) {
+		return
+	}
+	var (
+		config   = trackConfigs[track]
+		channel  = config.channel()
+		velocity = humanizeVelocity(track, config.scale(accent(step, groove.velocity(step, stepVelocity(track, step, trig)))&0x7F))
+		notes, n = stepNotes(track, step)
+	)
+	offset = humanizeOffset(track, offset)
+	scheduleLocks(track, step, offset, nframes, channel)
+	for _, note := range notes[:n] {
+		scheduleRatchets(track, step, offset, length, nframes, channel, quantize(note), velocity)
+	}
+	scheduleLayers(track, step, offset, length, nframes, notes[:n], velocity)
 }
@@ -0,0 +1,148 @@
+package main
+
+var (
+	focus int // Track shown and edited in the note view.
+
+	// noteIntervals are the semitones above the track's base note that the rows
+	// of the note view play when notes are not quantized, from the bottom row up: a major scale.
+	noteIntervals = [gridSize]uint8{0, 2, 4, 5, 7, 9, 11, 12}
+)
+
+// lightNoteColumn shows the notes of the focus track's step in the note and chord views.
+// The pad on the row of the step's note is green, pads on rows of its chord are amber,
+// and the rest of the column is dark.
+func lightNoteColumn(step int, ledBuffer MidiBuffer) int {
+	x, _, ok := stepPad(focus, step)
+	if !ok {
+		return 0
+	}
+	var (
+		on          = trigs[focus][step] > 0
+		row, hasRow = noteRow(focus, noteFor(focus, step))
+		chord       = bank[slot].Chords[focus][step]
+	)
+	for y := 0; y < gridSize; y++ {
+		g, r := 0, 0
+		switch {
+		case !on:
+		case hasRow && y == row:
+			g = 3
+		case chord&(1<<uint(y)) != 0:
+			g, r = 3, 3
+		}
+		if code := light(x, y, g, r, ledBuffer); isFailure(code) {
+			return code
+		}
+	}
+	return 0
+}
+
+// noteFor returns the note a step plays. Steps without a note play the track's configured note.
+func noteFor(track, step int) uint8 {
+	if n := bank[slot].Notes[track][step]; n > 0 {
+		return n
+	}
+	return trackConfigs[track].Note
+}
+
+// noteRow returns the row of the note view that plays a note of a track.
+// ok is false if no row plays it.
+func noteRow(track int, note uint8) (y int, ok bool) {
+	for y := 0; y < gridSize; y++ {
+		if rowNote(track, y) == note {
+			return y, true
+		}
+	}
+	return 0, false
+}
+
+// rowNote returns the note a row of the note view plays for a track.
+// With a scale the rows play consecutive notes of the scale from the track's note up.
+// Rows above note 127 play 127.
+func rowNote(track, y int) uint8 {
+	var (
+		base   = trackConfigs[track].Note
+		degree = gridSize - 1 - y
+	)
+	if scale == nil {
+		return clampNote(int(base) + int(noteIntervals[degree]))
+	}
+	note := base
+	for !inScale(note) {
+		note++
+	}
+	for ; degree > 0; degree-- {
+		note++
+		for !inScale(note) {
+			note++
+		}
+	}
+	return clampNote(int(note))
+}
+
+// clampNote limits a note to 127, the highest MIDI note.
+func clampNote(n int) uint8 {
+	if n > 127 {
+		return 127
+	}
+	return uint8(n)
+}
+
+// pianoRoll reports whether the grid shows the notes of the focus track.
+func pianoRoll() bool {
+	return view == viewNotes || view == viewChords
+}
+
+// selectFocus makes a track the one shown in the note view.
+func selectFocus(track int) {
+	focus = track
+	gridPainted = false
+}
+
+// setNote handles a pad press in the note view.
+// The step of the focus track in the pad's column gets the row's note and is turned on,
+// or turned off if it already plays that note.
+func setNote(step, y int, ledBuffer MidiBuffer) int {
+	note := rowNote(focus, y)
+
+	if trigs[focus][step] > 0 && noteFor(focus, step) == note {
+		trigs[focus][step] = 0
+	} else {
+		bank[slot].Notes[focus][step] = note
+		if trigs[focus][step] == 0 {
+			trigs[focus][step] = defaultVelocity
+		}
+	}
+	return lightNoteColumn(step, ledBuffer)
+}
+
+// stepNotes returns the notes a step plays: its note followed by the notes of its chord,
+// transposed by the step's pitch.
+// The notes are returned in an array so that the process callback does not allocate.
+func stepNotes(track, step int) (notes [gridSize + 1]uint8, n int) {
+	notes[0], n = noteFor(track, step), 1
+
+	chord := bank[slot].Chords[track][step]
+	for y := 0; y < gridSize; y++ {
+		if note := rowNote(track, y); chord&(1<<uint(y)) != 0 && note != notes[0] {
+			notes[n] = note
+			n++
+		}
+	}
+	for i := range notes[:n] {
+		notes[i] = pitchNote(track, step, notes[i])
+	}
+	return notes, n
+}
+
+// toggleChordNote handles a pad press in the chord view.
+// The row's note is added to or removed from the chord of the focus track's step in the pad's column.
+// Adding a note to a step that is off turns it on.
+func toggleChordNote(step, y int, ledBuffer MidiBuffer) int {
+	if trigs[focus][step] == 0 {
+		trigs[focus][step] = defaultVelocity
+		bank[slot].Chords[focus][step] = 0
+	}
+	bank[slot].Chords[focus][step] ^= 1 << uint(y)
+	return lightNoteColumn(step, ledBuffer)
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	nsmAPIMajor = 1 // Version of the NSM API ndseq speaks.
+	nsmAPIMinor = 2
+)
+
+var (
+	nsmConn   *net.UDPConn // Connection to the New Session Manager server, if ndseq was started by one.
+	nsmServer *net.UDPAddr // Address of the NSM server.
+)
+
+// inSession reports whether ndseq was started by a New Session Manager.
+func inSession() bool {
+	return nsmConn != nil
+}
+
+// joinSession announces ndseq to the New Session Manager named by NSM_URL, if there is one,
+// and waits for it to say where the session keeps ndseq's files.
+// The project (with the pattern bank) and the connections are loaded from and saved to that directory,
+// and the JACK client is named after the session's client ID.
+// It does nothing if ndseq wasn't started by a session manager.
+func joinSession() error {
+	nsmURL := os.Getenv("NSM_URL")
+	if nsmURL == "" {
+		return nil
+	}
+	u, err := url.Parse(nsmURL)
+	if err != nil {
+		return errors.Wrap(err, "parsing NSM_URL")
+	}
+	if nsmServer, err = net.ResolveUDPAddr("udp", u.Host); err != nil {
+		return errors.Wrap(err, "resolving NSM server address")
+	}
+	if nsmConn, err = net.ListenUDP("udp", nil); err != nil {
+		return errors.Wrap(err, "listening for NSM server")
+	}
+	announce := encodeOSC("/nsm/server/announce", "ndseq", "", filepath.Base(os.Args[0]),
+		int32(nsmAPIMajor), int32(nsmAPIMinor), int32(os.Getpid()))
+	if _, err := nsmConn.WriteToUDP(announce, nsmServer); err != nil {
+		return errors.Wrap(err, "announcing to NSM server")
+	}
+	buf := make([]byte, 4096)
+	for {
+		n, _, err := nsmConn.ReadFromUDP(buf)
+		if err != nil {
+			return errors.Wrap(err, "reading from NSM server")
+		}
+		m, err := decodeOSC(buf[:n])
+		if err != nil {
+			continue
+		}
+		switch m.Address {
+		case "/error":
+			if len(m.Args) == 3 {
+				return errors.Errorf("NSM server: %v", m.Args[2])
+			}
+			return errors.New("NSM server refused ndseq")
+		case "/nsm/client/open":
+			if len(m.Args) != 3 {
+				continue
+			}
+			path, _ := m.Args[0].(string)
+			id, _ := m.Args[2].(string)
+			return openSession(path, id)
+		}
+	}
+}
+
+// openSession uses the files in the session directory and replies to the open message.
+func openSession(dir, id string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		replySession("/nsm/client/open", err)
+		return errors.Wrap(err, "creating session directory")
+	}
+	savePath = filepath.Join(dir, "project.json")
+	if _, err := os.Stat(savePath); err == nil {
+		loadPath = savePath
+	}
+	connectionsPath = filepath.Join(dir, "connections.json")
+	if id != "" {
+		clientName = id
+	}
+	replySession("/nsm/client/open", nil)
+	return nil
+}
+
+// serveSession saves the project and the connections when the session manager saves the session.
+// The session manager stops ndseq with SIGTERM, which it quits on without saving.
+// It does nothing unless ndseq was started by a session manager.
+func serveSession() error {
+	if !inSession() {
+		return nil
+	}
+	buf := make([]byte, 4096)
+	for {
+		n, _, err := nsmConn.ReadFromUDP(buf)
+		if err != nil {
+			return errors.Wrap(err, "reading from NSM server")
+		}
+		m, err := decodeOSC(buf[:n])
+		if err != nil || m.Address != "/nsm/client/save" {
+			continue
+		}
+		err = saveProject(savePath)
+		if err == nil {
+			err = saveConnections(connectionsPath)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "saving session: %s\n", err)
+		}
+		replySession("/nsm/client/save", err)
+	}
+}
+
+// replySession tells the session manager whether a request succeeded.
+func replySession(address string, err error) {
+	reply := encodeOSC("/reply", address, "OK")
+	if err != nil {
+		reply = encodeOSC("/error", address, int32(-1), err.Error())
+	}
+	_, _ = nsmConn.WriteToUDP(reply, nsmServer) // Best effort.
+}
@@ -0,0 +1,45 @@
+package main
+
+var (
+	nudgeMillis int   // Milliseconds a nudge moves the playhead by.
+	nudgeOffset int64 // Samples the internal clock's steps are moved by, later if positive.
+)
+
+// nudge moves the steps of the internal clock by nudgeMillis against the MIDI clock,
+// later if dir is positive and earlier if it is negative.
+func nudge(dir int64) {
+	nudgeOffset += dir * ((int64(nudgeMillis) * int64(sampleRate)) / 1000)
+}
+
+// nudgePad handles a pad press in the fifth row while a top-row button is held.
+// The outer pads move the playhead back and forward by a step without changing the timing,
+// and the pads next to them nudge it back and forward in time by nudgeMillis.
+func nudgePad(x int) {
+	switch x {
+	case 0:
+		nudgeStep(-1)
+	case 1:
+		nudge(1)
+	case gridSize - 2:
+		nudge(-1)
+	case gridSize - 1:
+		nudgeStep(1)
+	}
+}
+
+// nudgeStep moves the playhead of the pattern and its tracks forward or back by a master step.
+func nudgeStep(dir int) {
+	if dir > 0 {
+		beat = nextBeat(beat)
+		for track := range trackPos {
+			advanceTrack(track)
+		}
+		return
+	}
+	beat = prevBeat(beat)
+	for track := range trackPos {
+		if adv := advance(track); trackPos[track] >= adv {
+			trackPos[track] -= adv
+		}
+	}
+}
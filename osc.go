@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+
+	"github.com/pkg/errors"
+)
+
+// oscMessage is an OSC message with int32, float32 and string arguments.
+type oscMessage struct {
+	Address string
+	Args    []interface{}
+}
+
+// encodeOSC encodes an OSC message. Arguments must be int32, float32 or string.
+func encodeOSC(address string, args ...interface{}) []byte {
+	var (
+		buf  bytes.Buffer
+		tags = []byte{','}
+	)
+	for _, arg := range args {
+		switch arg.(type) {
+		case int32:
+			tags = append(tags, 'i')
+		case float32:
+			tags = append(tags, 'f')
+		case string:
+			tags = append(tags, 's')
+		}
+	}
+	writeOSCString(&buf, address)
+	writeOSCString(&buf, string(tags))
+
+	for _, arg := range args {
+		switch v := arg.(type) {
+		case int32:
+			_ = binary.Write(&buf, binary.BigEndian, v)
+		case float32:
+			_ = binary.Write(&buf, binary.BigEndian, math.Float32bits(v))
+		case string:
+			writeOSCString(&buf, v)
+		}
+	}
+	return buf.Bytes()
+}
+
+// writeOSCString writes a string null-terminated and padded to a multiple of 4 bytes.
+func writeOSCString(buf *bytes.Buffer, s string) {
+	buf.WriteString(s)
+	buf.Write(make([]byte, 4-(len(s)%4)))
+}
+
+// decodeOSC decodes an OSC message. Bundles and other argument types are not supported.
+func decodeOSC(data []byte) (oscMessage, error) {
+	var m oscMessage
+
+	address, data, err := readOSCString(data)
+	if err != nil {
+		return m, errors.Wrap(err, "reading address")
+	}
+	m.Address = address
+
+	if len(data) == 0 {
+		return m, nil // No type tags.
+	}
+	tags, data, err := readOSCString(data)
+	if err != nil {
+		return m, errors.Wrap(err, "reading type tags")
+	}
+	if len(tags) == 0 || tags[0] != ',' {
+		return m, errors.New("type tags must start with a comma")
+	}
+	for _, tag := range tags[1:] {
+		switch tag {
+		case 'i', 'f':
+			if len(data) < 4 {
+				return m, errors.New("argument is truncated")
+			}
+			v := binary.BigEndian.Uint32(data)
+			if tag == 'i' {
+				m.Args = append(m.Args, int32(v))
+			} else {
+				m.Args = append(m.Args, math.Float32frombits(v))
+			}
+			data = data[4:]
+		case 's':
+			var s string
+			if s, data, err = readOSCString(data); err != nil {
+				return m, errors.Wrap(err, "reading string argument")
+			}
+			m.Args = append(m.Args, s)
+		default:
+			return m, errors.Errorf("unsupported type tag %q", tag)
+		}
+	}
+	return m, nil
+}
+
+// readOSCString reads a padded OSC string and returns it with the data after it.
+func readOSCString(data []byte) (string, []byte, error) {
+	end := bytes.IndexByte(data, 0)
+	if end < 0 {
+		return "", nil, errors.New("string is not terminated")
+	}
+	n := (end + 4) &^ 3
+	if n > len(data) {
+		n = len(data)
+	}
+	return string(data[:end]), data[n:], nil
+}
+
+// ints returns the arguments of a message if there are n of them and they are all int32.
+func (m oscMessage) ints(n int) ([]int32, bool) {
+	if len(m.Args) != n {
+		return nil, false
+	}
+	v := make([]int32, n)
+	for i, arg := range m.Args {
+		var ok bool
+		if v[i], ok = arg.(int32); !ok {
+			return nil, false
+		}
+	}
+	return v, true
+}
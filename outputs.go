@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+)
+
+var (
+	splitTracks  bool          // Flag telling us if every track has its own output port.
+	trackOutputs [8]*Port      // JACK ports for sending each track's MIDI data, when split.
+	trackBuffers [8]MidiBuffer // Buffers of the track ports for the current period.
+)
+
+// addTrackPorts adds an output port per track when tracks are split.
+// The ports are not connected automatically; route them in the JACK graph.
+func addTrackPorts() {
+	if !splitTracks {
+		return
+	}
+	for track := range trackOutputs {
+		Ports.Outputs[trackPortName(track)] = &Port{Matches: none}
+	}
+}
+
+// clearTrackBuffers gets the buffers of the track ports for the current period.
+func clearTrackBuffers(nframes uint32) {
+	if !splitTracks {
+		return
+	}
+	for track, port := range trackOutputs {
+		trackBuffers[track] = backend.Buffer(port, nframes)
+	}
+}
+
+// setTrackOutputs looks up the registered track ports.
+func setTrackOutputs() {
+	if !splitTracks {
+		return
+	}
+	for track := range trackOutputs {
+		trackOutputs[track] = Ports.Outputs[trackPortName(track)]
+	}
+}
+
+// trackPortName returns the name of a track's output port, numbered from 1.
+func trackPortName(track int) string {
+	return fmt.Sprintf("Track%dSend", track+1)
+}
+
+// writeEvent writes a queued message to the port it belongs to:
+// its track's port when tracks are split, the click port for clicks when
+// the click is split, and the Nord Drum port otherwise.
+// Messages of tracks sent as MIDI 2.0 packets go to the UMP port instead (see writeUMP).
+// Messages of tracks played on the RTP-MIDI peers are handed to serveRTPMIDI as well.
+func writeEvent(e *queuedEvent, outBuffer MidiBuffer) int {
+	if e.track >= 0 && e.track < len(trackConfigs) && trackConfigs[e.track].RTPMIDI {
+		sendRTP(e)
+	}
+	if isUMP(e.track) {
+		return writeUMP(e)
+	}
+	var (
+		port   = ndOutput
+		buffer = outBuffer
+	)
+	switch {
+	case splitTracks && e.track >= 0 && e.track < len(trackOutputs):
+		port, buffer = trackOutputs[e.track], trackBuffers[e.track]
+	case splitClick && e.track == clickTrack:
+		port, buffer = clickOutput, clickBuffer
+	}
+	return backend.Write(port, &MidiEvent{Time: e.time, Buffer: e.data[:e.size]}, buffer)
+}
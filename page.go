@@ -0,0 +1,63 @@
+package main
+
+var follow bool // Flag telling us if the visible page follows the playhead.
+
+// numPages returns the number of pages of steps in the pattern.
+func numPages() int {
+	return (steps + gridSize - 1) / gridSize
+}
+
+// lastPage returns the last page the first controller can show.
+// While a second Launchpad spans the pattern it shows the page after the first one's, so the first stops a page early.
+func lastPage() int {
+	last := numPages() - 1 - gridPage(len(grids)-1)
+	if last < 0 {
+		return 0
+	}
+	return last
+}
+
+// setPage shows a page of steps, if the pattern has it, and repaints the grid on the next cycle.
+func setPage(p int) {
+	if p < 0 || p > lastPage() || p == page {
+		return
+	}
+	page = p
+	gridPainted = false
+}
+
+// turnPage moves the visible page by delta pages, wrapping around at the ends of the pattern.
+// Turning the page by hand stops it following the playhead.
+func turnPage(delta int) {
+	n := lastPage() + 1
+	follow = false
+	setPage((((page + delta) % n) + n) % n)
+}
+
+// followPlayhead shows the page of a step if the visible page follows the playhead.
+// Steps on the last page are shown by the second Launchpad while it spans the pattern.
+func followPlayhead(step int) {
+	if !follow {
+		return
+	}
+	if p := step / gridSize; p > lastPage() {
+		setPage(lastPage())
+	} else {
+		setPage(p)
+	}
+}
+
+// pagePad handles a pad press in the middle of the fifth row while a top-row button is held.
+// The outer two of the four pads show the previous and next pages,
+// and the inner two turn following the playhead on or off.
+func pagePad(x int) {
+	switch x {
+	case 2:
+		turnPage(-1)
+	case 3, 4:
+		follow = !follow
+		followPlayhead(beat)
+	case 5:
+		turnPage(1)
+	}
+}
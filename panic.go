@@ -0,0 +1,37 @@
+package main
+
+const (
+	ccAllSoundOff = 120 // Channel mode message that silences a channel immediately.
+	ccAllNotesOff = 123 // Channel mode message that releases every note of a channel.
+)
+
+// midiPanic silences everything connected to the outputs, for when a note gets stuck.
+// The scheduled messages are dropped and all notes off and all sound off are sent on every channel
+// (and on each track's channel of the track ports, when tracks are split,
+// and the click's channel of the click port, when the click is split).
+// It must only be called from the process callback.
+func midiPanic() {
+	pending.n = 0
+
+	for channel := byte(0); channel < 16; channel++ {
+		queue(-1, 0, 0xB0|channel, ccAllNotesOff, 0)
+		queue(-1, 0, 0xB0|channel, ccAllSoundOff, 0)
+	}
+	if splitClick {
+		channel := byte(clickChannel-1) & 0x0F
+		queue(clickTrack, 0, 0xB0|channel, ccAllNotesOff, 0)
+		queue(clickTrack, 0, 0xB0|channel, ccAllSoundOff, 0)
+	}
+	if !splitTracks {
+		return
+	}
+	for track, config := range trackConfigs {
+		queue(track, 0, 0xB0|config.channel(), ccAllNotesOff, 0)
+		queue(track, 0, 0xB0|config.channel(), ccAllSoundOff, 0)
+
+		for _, l := range config.Layers {
+			queue(track, 0, 0xB0|l.channel(), ccAllNotesOff, 0)
+			queue(track, 0, 0xB0|l.channel(), ccAllSoundOff, 0)
+		}
+	}
+}
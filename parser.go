@@ -0,0 +1,166 @@
+package main
+
+const (
+	maxSysex    = 1024         // Longest sysex message the parser keeps. Longer ones are dropped.
+	maxParsed   = 256          // Most messages the parser returns for a port in a period. Further ones are dropped.
+	parsedBytes = 2 * maxSysex // Room for the bytes of the messages the parser splits out of or joins across events in a period.
+)
+
+// midiParser splits the bytes received on a port into complete MIDI messages, whatever events they came in:
+// it fills in running status, joins sysex messages split across events, and takes out
+// the realtime messages interleaved with other messages as messages of their own.
+type midiParser struct {
+	running byte // Running status: status of the last channel message, or 0.
+	status  byte // Status of the message being parsed, or 0.
+	data    [2]byte
+	n       int // Number of data bytes of the message being parsed.
+
+	sysex   [maxSysex]byte
+	sysexN  int  // Number of bytes of the sysex message being parsed, or 0 if there is none.
+	tooLong bool // Flag telling us if the sysex message being parsed is too long to keep.
+
+	// The messages returned by parse and their bytes are kept here and reused every period,
+	// so that the process callback does not allocate.
+	out    []*MidiEvent
+	events [maxParsed]*MidiEvent
+	parsed [maxParsed]MidiEvent // Messages split out of or joined across events.
+	nparse int
+	bytes  [parsedBytes]byte // Bytes of the parsed messages.
+	nbytes int
+}
+
+// dataBytes returns the number of data bytes of the message a status byte starts.
+func dataBytes(status byte) int {
+	switch {
+	case status >= 0xC0 && status < 0xE0, status == 0xF1, status == 0xF3:
+		return 1
+	case status >= 0x80 && status < 0xF0, status == 0xF2:
+		return 2
+	}
+	return 0
+}
+
+// parse returns the complete messages in the events of a period, which are valid until the next period.
+// Events that are one complete message each, as most are, are handed on as they are.
+func (mp *midiParser) parse(events []*MidiEvent) []*MidiEvent {
+	mp.out, mp.nparse, mp.nbytes = mp.events[:0], 0, 0
+
+	for _, e := range events {
+		if mp.idle() && complete(e.Buffer) {
+			if s := e.Buffer[0]; s < 0xF0 {
+				mp.running = s
+			} else if s < 0xF8 {
+				mp.running = 0
+			}
+			if len(mp.out) < maxParsed {
+				mp.out = append(mp.out, e)
+			}
+			continue
+		}
+		mp.feed(e.Buffer, e.Time)
+	}
+	return mp.out
+}
+
+// emit adds a message made of a status byte and its data bytes to the messages returned by parse,
+// or drops it if there is no room left for it in the period.
+func (mp *midiParser) emit(time uint32, status byte, data []byte) {
+	n := 1 + len(data)
+	if len(mp.out) == maxParsed || mp.nbytes+n > parsedBytes {
+		return
+	}
+	buf := mp.bytes[mp.nbytes : mp.nbytes+n]
+	buf[0] = status
+	copy(buf[1:], data)
+	mp.nbytes += n
+
+	e := &mp.parsed[mp.nparse]
+	e.Time, e.Buffer = time, buf
+	mp.nparse++
+	mp.out = append(mp.out, e)
+}
+
+// idle reports whether the parser is between messages.
+func (mp *midiParser) idle() bool {
+	return mp.status == 0 && mp.sysexN == 0
+}
+
+// complete reports whether the bytes of an event are one complete message with its status byte.
+func complete(buf []byte) bool {
+	if len(buf) == 0 || buf[0] < 0x80 {
+		return false
+	}
+	if buf[0] == 0xF0 {
+		if buf[len(buf)-1] != 0xF7 {
+			return false
+		}
+		buf = buf[:len(buf)-1]
+	} else if len(buf) != 1+dataBytes(buf[0]) {
+		return false
+	}
+	for _, b := range buf[1:] {
+		if b >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
+
+// feed parses the bytes of an event received at a time, emitting each message they complete.
+func (mp *midiParser) feed(buf []byte, time uint32) {
+	for _, b := range buf {
+		switch {
+		case b >= 0xF8: // Realtime messages can come between any two bytes.
+			mp.emit(time, b, nil)
+		case b == 0xF0:
+			mp.status, mp.running, mp.n = 0, 0, 0
+			mp.sysex[0], mp.sysexN, mp.tooLong = b, 1, false
+		case b == 0xF7:
+			if mp.sysexN > 0 && !mp.tooLong && mp.sysexN < maxSysex {
+				mp.sysex[mp.sysexN] = b
+				mp.emit(time, sysexStart, mp.sysex[1:mp.sysexN+1])
+			}
+			mp.sysexN = 0
+		case b >= 0x80:
+			mp.sysexN = 0 // A sysex message ended by another status byte is dropped.
+			mp.status, mp.n = b, 0
+			mp.running = 0
+			if b < 0xF0 {
+				mp.running = b
+			}
+			if dataBytes(b) == 0 {
+				mp.emit(time, b, nil)
+				mp.status = 0
+			}
+		case mp.sysexN > 0:
+			if mp.sysexN == maxSysex {
+				mp.tooLong = true
+				continue
+			}
+			mp.sysex[mp.sysexN] = b
+			mp.sysexN++
+		default:
+			if mp.status == 0 {
+				mp.status = mp.running
+			}
+			if mp.status == 0 {
+				continue // Data bytes without a status are dropped.
+			}
+			mp.data[mp.n] = b
+			mp.n++
+			if mp.n == dataBytes(mp.status) {
+				mp.emit(time, mp.status, mp.data[:mp.n])
+				mp.status, mp.n = 0, 0
+			}
+		}
+	}
+}
+
+// parserBackend splits the bytes another backend reads from a port into complete messages (see midiParser).
+type parserBackend struct {
+	Backend
+}
+
+func (b parserBackend) Events(p *Port, nframes uint32) []*MidiEvent {
+	return p.parser.parse(b.Backend.Events(p, nframes))
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestMidiParser(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		events [][]byte   // Bytes of the events received, one period each.
+		want   [][][]byte // Messages parsed in each period.
+	}{
+		{
+			name:   "complete messages",
+			events: [][]byte{{0x90, 60, 100}, {0xC1, 5}, {0xF8}},
+			want:   [][][]byte{{{0x90, 60, 100}}, {{0xC1, 5}}, {{0xF8}}},
+		},
+		{
+			name:   "running status",
+			events: [][]byte{{0x92, 60, 100, 62, 90}, {64, 0}},
+			want:   [][][]byte{{{0x92, 60, 100}, {0x92, 62, 90}}, {{0x92, 64, 0}}},
+		},
+		{
+			name:   "running status after realtime",
+			events: [][]byte{{0xB3, 7, 100, 0xF8, 10, 64}},
+			want:   [][][]byte{{{0xB3, 7, 100}, {0xF8}, {0xB3, 10, 64}}},
+		},
+		{
+			name:   "realtime inside a channel message",
+			events: [][]byte{{0x90, 0xF8, 36, 0xFA, 127}},
+			want:   [][][]byte{{{0xF8}, {0xFA}, {0x90, 36, 127}}},
+		},
+		{
+			name:   "channel message split across events",
+			events: [][]byte{{0xE5, 0}, {64}},
+			want:   [][][]byte{nil, {{0xE5, 0, 64}}},
+		},
+		{
+			name:   "sysex split across events",
+			events: [][]byte{{0xF0, 0x00, 0x20}, {0x29, 0x02}, {0x0D, 0xF7}},
+			want:   [][][]byte{nil, nil, {{0xF0, 0x00, 0x20, 0x29, 0x02, 0x0D, 0xF7}}},
+		},
+		{
+			name:   "realtime inside sysex",
+			events: [][]byte{{0xF0, 0x7E, 0xF8, 0x06}, {0xFE, 0x02, 0xF7}},
+			want:   [][][]byte{{{0xF8}}, {{0xFE}, {0xF0, 0x7E, 0x06, 0x02, 0xF7}}},
+		},
+		{
+			name:   "sysex cut short by a status",
+			events: [][]byte{{0xF0, 0x7E, 0x06}, {0x90, 36, 100}},
+			want:   [][][]byte{nil, {{0x90, 36, 100}}},
+		},
+		{
+			name:   "sysex cancels running status",
+			events: [][]byte{{0x90, 36, 100}, {0xF0, 0x7E, 0xF7}, {38, 100}},
+			want:   [][][]byte{{{0x90, 36, 100}}, {{0xF0, 0x7E, 0xF7}}, nil},
+		},
+		{
+			name:   "system common cancels running status",
+			events: [][]byte{{0x90, 36, 100, 0xF2, 0, 1, 38, 100}},
+			want:   [][][]byte{{{0x90, 36, 100}, {0xF2, 0, 1}}},
+		},
+		{
+			name:   "tune request",
+			events: [][]byte{{0xF6, 0xF1, 0x12}},
+			want:   [][][]byte{{{0xF6}, {0xF1, 0x12}}},
+		},
+		{
+			name:   "data without status",
+			events: [][]byte{{36, 100}, {0x80, 36, 0}},
+			want:   [][][]byte{nil, {{0x80, 36, 0}}},
+		},
+	} {
+		var mp midiParser
+		for i, buf := range tc.events {
+			got := mp.parse([]*MidiEvent{{Time: uint32(i), Buffer: buf}})
+			if len(got) != len(tc.want[i]) {
+				t.Errorf("%s: period %d: got %d messages, want %d", tc.name, i, len(got), len(tc.want[i]))
+				continue
+			}
+			for j, e := range got {
+				if !bytes.Equal(e.Buffer, tc.want[i][j]) {
+					t.Errorf("%s: period %d: message %d is % X, want % X", tc.name, i, j, e.Buffer, tc.want[i][j])
+				}
+				if e.Time != uint32(i) {
+					t.Errorf("%s: period %d: message %d at %d, want %d", tc.name, i, j, e.Time, i)
+				}
+			}
+		}
+	}
+}
+
+func TestMidiParserLongSysex(t *testing.T) {
+	var (
+		mp  midiParser
+		buf = append([]byte{0xF0}, make([]byte, maxSysex)...)
+	)
+	buf = append(buf, 0xF7, 0x90, 36, 100)
+
+	got := mp.parse([]*MidiEvent{{Buffer: buf}})
+	if len(got) != 1 || !bytes.Equal(got[0].Buffer, []byte{0x90, 36, 100}) {
+		t.Errorf("got %d messages, want only the note on after the dropped sysex", len(got))
+	}
+}
+
+func TestMidiParserKeepsCompleteEvents(t *testing.T) {
+	var (
+		mp midiParser
+		e  = &MidiEvent{Time: 3, Buffer: []byte{0xB0, 1, 2}}
+	)
+	if got := mp.parse([]*MidiEvent{e}); len(got) != 1 || got[0] != e {
+		t.Errorf("a complete event was not handed on as it is")
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+// performPad handles a pad press on a performance controller.
+// Its pads work as the pads of the first controller do while a top-row button is held (see topPad),
+// without having to hold one.
+func performPad(x, y int, pressed bool) int {
+	if !pressed {
+		return 0
+	}
+	topPad(x, y)
+	gridPainted = false
+	return 0
+}
+
+// paintPerform lights the pads of a performance controller, showing what each row does
+// and the loop, note repeat, recording and parameter page that are set.
+func paintPerform(ledBuffer MidiBuffer) int {
+	for y := 0; y < gridSize; y++ {
+		for x := 0; x < gridSize; x++ {
+			g, r := performColor(x, y)
+			if code := light(x, y, g, r, ledBuffer); isFailure(code) {
+				return code
+			}
+		}
+	}
+	return 0
+}
+
+// performColor returns the color of a pad of a performance controller.
+func performColor(x, y int) (g, r int) {
+	switch y {
+	case 0: // Tempo: slower on the left, tap in the middle, faster on the right.
+		switch {
+		case x < 3:
+			return 0, 2
+		case x < 5:
+			return 2, 2
+		default:
+			return 2, 0
+		}
+	case 1, 2: // Loop start and end.
+		step := (page * gridSize) + x
+		if loopEnd >= 0 && step >= loopStart && step <= loopEnd {
+			return 3, 0
+		}
+		return 1, 0
+	case 3: // Clear the loop.
+		return 0, 1
+	case 4: // Nudge and pages.
+		switch x {
+		case 0, gridSize - 1:
+			return 2, 2
+		case 1, gridSize - 2:
+			return 1, 1
+		case 2, 5:
+			return 1, 0
+		case 3, 4:
+			if follow {
+				return 3, 0
+			}
+			return 1, 0
+		}
+	case 5: // Note repeat.
+		switch {
+		case x < len(repeatRates) && repeatPulses == repeatRates[x]:
+			return 3, 0
+		case x < len(repeatRates):
+			return 1, 0
+		case x == gridSize-1:
+			return 0, 1
+		}
+	case 6: // Recording and the metronome.
+		switch {
+		case x == 0 && recording:
+			return 0, 3
+		case x == 1 && replacing:
+			return 2, 2
+		case x == gridSize-1 && metronome:
+			return 3, 0
+		case x == 0, x == 1, x == gridSize-1:
+			return 1, 0
+		}
+	case 7: // Parameter pages.
+		switch {
+		case x == editPage:
+			return 3, 1
+		case x < len(editPages), x == pitchPage:
+			return 1, 0
+		}
+	}
+	return 0, 0
+}
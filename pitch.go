@@ -0,0 +1,84 @@
+package main
+
+import (
+	"github.com/pkg/errors"
+)
+
+const (
+	pitchPage = gridSize - 1 // Parameter page index of the pitch page, the last pad of the row that picks pages.
+	maxPitch  = 48           // Largest number of semitones a step can be transposed by either way.
+)
+
+// lightPitchColumn updates the column of the pitch page that shows a step of the focus track.
+// The lit row is the step's pitch, from the bottom row (the track's note) up to 7 semitones above it.
+// Pitches beyond the rows light the top or bottom row red.
+func lightPitchColumn(step int, ledBuffer MidiBuffer) int {
+	x, _, ok := stepPad(focus, step)
+	if !ok {
+		return 0
+	}
+	p := int(bank[slot].Pitch[focus][step])
+
+	for y := 0; y < gridSize; y++ {
+		g, r := 0, 0
+		switch row := gridSize - 1 - y; {
+		case row == p:
+			g = 3
+		case row == gridSize-1 && p > row, row == 0 && p < 0:
+			r = 3
+		}
+		if code := light(x, y, g, r, ledBuffer); isFailure(code) {
+			return code
+		}
+	}
+	return 0
+}
+
+// paintPitch lights every column of the pitch page.
+func paintPitch(ledBuffer MidiBuffer) int {
+	for x := 0; x < gridSize; x++ {
+		if code := lightPitchColumn((page*gridSize)+x, ledBuffer); isFailure(code) {
+			return code
+		}
+	}
+	return 0
+}
+
+// pitchNote transposes a note by a step's pitch, limited to 0-127.
+func pitchNote(track, step int, note uint8) uint8 {
+	n := int(note) + int(bank[slot].Pitch[track][step])
+
+	switch {
+	case n < 0:
+		return 0
+	case n > 127:
+		return 127
+	}
+	return uint8(n)
+}
+
+// setPitch handles a pad press on the pitch page: the focus track's step in the pad's column
+// is transposed by the row's number of semitones, counting up from the bottom row.
+// The step's trig is left as it is, so the pitch lane can be programmed separately.
+func setPitch(x, y int, ledBuffer MidiBuffer) int {
+	step := (page * gridSize) + x
+	if step >= steps {
+		return 0
+	}
+	bank[slot].Pitch[focus][step] = int8(gridSize - 1 - y)
+	return lightPitchColumn(step, ledBuffer)
+}
+
+// validatePitches checks the pitch lanes of the patterns in a bank.
+func validatePitches(b *[numSlots]Pattern) error {
+	for i := range b {
+		for track := range b[i].Pitch {
+			for step, p := range b[i].Pitch[track] {
+				if p < -maxPitch || p > maxPitch {
+					return errors.Errorf("slot %d track %d step %d: pitch must be from %d to %d", i, track, step, -maxPitch, maxPitch)
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package main
+
+var (
+	// rngState is the state of the xorshift generator used by the process callback.
+	// It must never be zero.
+	rngState uint32 = 2463534242
+
+	// randomSeed varies random playback directions between runs.
+	randomSeed uint64
+)
+
+// chance reports whether an event with the given percent probability happens.
+func chance(percent uint8) bool {
+	return percent >= 100 || rand()%100 < uint32(percent)
+}
+
+// cycleProbability steps a trig's probability down from 100% in quarters, wrapping to 100%.
+func cycleProbability(track, step int) {
+	p := probability(track, step) - 25
+	if p <= 0 {
+		p = 100
+	}
+	bank[slot].Probability[track][step] = uint8(p)
+}
+
+// probability returns a trig's probability in percent.
+func probability(track, step int) int {
+	if p := bank[slot].Probability[track][step]; p > 0 {
+		return int(p)
+	}
+	return 100
+}
+
+// rand returns a pseudo-random number from a xorshift generator.
+// It does not allocate or lock, so it is safe to call from the process callback.
+func rand() uint32 {
+	x := rngState
+	x ^= x << 13
+	x ^= x >> 17
+	x ^= x << 5
+	rngState = x
+	return x
+}
+
+// seedRand seeds the pseudo-random number generator.
+func seedRand(seed uint32) {
+	if seed == 0 {
+		seed = 1
+	}
+	rngState = seed
+	randomSeed = uint64(rand())<<32 | uint64(rand())
+}
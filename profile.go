@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/pkg/errors"
+	flag "github.com/spf13/pflag"
+	"gopkg.in/yaml.v2"
+)
+
+// Profile describes an output device, so that ndseq can drive drum modules other than the Nord Drum 3p.
+type Profile struct {
+	Name   string           `yaml:"name" toml:"name"`     // Name of the device, for humans.
+	Port   string           `yaml:"port" toml:"port"`     // Name of the JACK port the device is connected to.
+	Tracks []TrackConfig    `yaml:"tracks" toml:"tracks"` // Channel, note and velocity scale of each track.
+	CC     map[string]uint8 `yaml:"cc" toml:"cc"`         // CC numbers by parameter name, for locks and LFOs.
+	Pages  []EditPage       `yaml:"pages" toml:"pages"`   // Parameter pages edited on the grid. Empty keeps the Nord Drum 3p's.
+}
+
+var (
+	profilePath string           // Device profile file. Empty keeps the Nord Drum 3p defaults.
+	ccNames     map[string]uint8 // CC numbers by parameter name, from the device profile.
+)
+
+// CC is a MIDI CC number.
+// In project files it can be given as a number or as a parameter name from the device profile.
+type CC uint8
+
+// UnmarshalJSON decodes a CC number or parameter name.
+func (c *CC) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err != nil {
+		var n uint8
+		if err := json.Unmarshal(data, &n); err != nil {
+			return errors.New("cc must be a number or a parameter name")
+		}
+		*c = CC(n)
+		return nil
+	}
+	n, ok := ccNames[name]
+	if !ok {
+		return errors.Errorf("unknown cc %q", name)
+	}
+	*c = CC(n)
+	return nil
+}
+
+// loadProfile reads a device profile and applies it.
+// The JACK port and track configs given on the command line take precedence.
+// It does nothing if path is empty.
+func loadProfile(path string) error {
+	if path == "" {
+		return nil
+	}
+	p, err := readProfile(path)
+	if err != nil {
+		return err
+	}
+	if err := p.validate(); err != nil {
+		return err
+	}
+	if !flag.CommandLine.Changed("nd") && p.Port != "" {
+		nd = p.Port
+	}
+	if trackPath == "" && len(p.Tracks) > 0 {
+		copy(trackConfigs[:], p.Tracks)
+	}
+	ccNames = p.CC
+	if len(p.Pages) > 0 {
+		return resolvePages(p.Pages, p.CC)
+	}
+	return nil
+}
+
+// readProfile reads a device profile from a YAML or TOML file, depending on its extension.
+func readProfile(path string) (Profile, error) {
+	var p Profile
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".toml":
+		if _, err := toml.DecodeFile(path, &p); err != nil {
+			return p, errors.Wrap(err, "decoding profile")
+		}
+	case ".yaml", ".yml":
+		f, err := os.Open(path)
+		if err != nil {
+			return p, errors.Wrap(err, "opening profile")
+		}
+		defer func() { _ = f.Close() }() // Best effort.
+
+		if err := yaml.NewDecoder(f).Decode(&p); err != nil {
+			return p, errors.Wrap(err, "decoding profile")
+		}
+	default:
+		return p, errors.Errorf("profile %s must be a .yaml, .yml or .toml file", path)
+	}
+	return p, nil
+}
+
+// validate checks the profile's tracks and CCs.
+func (p Profile) validate() error {
+	if len(p.Tracks) > 0 && len(p.Tracks) != len(trackConfigs) {
+		return errors.Errorf("profile must have %d tracks", len(trackConfigs))
+	}
+	for i, c := range p.Tracks {
+		if err := c.validate(); err != nil {
+			return errors.Wrapf(err, "track %d", i)
+		}
+	}
+	for name, n := range p.CC {
+		if n > 119 {
+			return errors.Errorf("cc %s must be between 0 and 119", name)
+		}
+	}
+	return nil
+}
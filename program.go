@@ -0,0 +1,36 @@
+package main
+
+const (
+	programsPerBank = 128                   // Number of programs a Program Change selects from.
+	maxProgram      = 128 * programsPerBank // Highest program number, in the last of the banks addressed with CC 0.
+	ccBankMSB       = 0                     // CC that selects the high 7 bits of a bank.
+	ccBankLSB       = 32                    // CC that selects the low 7 bits of a bank.
+)
+
+var (
+	programChannel int  // MIDI channel program changes are sent on, from 1 to 16.
+	programDue     bool // Flag telling us if the playing pattern's program is still to be sent.
+)
+
+// scheduleProgram schedules the selection of a program at an offset from the start of the current period.
+// Programs are numbered from 1 across banks of 128, so program 129 is the first of the second bank.
+// The bank select is sent before every Program Change.
+func scheduleProgram(track int, offset, nframes uint32, program int) {
+	var (
+		channel = byte(programChannel-1) & 0x0F
+		p       = program - 1
+		b       = p / programsPerBank
+	)
+	later(track, offset, nframes, 0xB0|channel, ccBankMSB, byte(b>>7))
+	later(track, offset, nframes, 0xB0|channel, ccBankLSB, byte(b&0x7F))
+	later(track, offset, nframes, 0xC0|channel, byte(p%programsPerBank))
+}
+
+// sendProgram selects the playing pattern's program when it starts, at an offset from the start of the current period.
+func sendProgram(offset, nframes uint32) {
+	if !programDue {
+		return
+	}
+	programDue = false
+	scheduleProgram(-1, offset, nframes, bank[slot].Program)
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	flag "github.com/spf13/pflag"
+)
+
+// Project is the on-disk representation of a sequencer session.
+type Project struct {
+	Tempo float64             `json:"tempo"`
+	Steps int                 `json:"steps"`
+	Swing int                 `json:"swing"`
+	ND    string              `json:"nd"`
+	Scale string              `json:"scale,omitempty"`
+	Root  string              `json:"root,omitempty"`
+	Kit   string              `json:"kit,omitempty"`
+	Slot  int                 `json:"slot"`
+	Bank  [numSlots]Pattern   `json:"bank"`
+	Song  []SongEntry         `json:"song,omitempty"`
+	LFOs  []LFO               `json:"lfos,omitempty"`
+	Trigs *[8][maxSteps]uint8 `json:"trigs,omitempty"` // Single pattern saved before banks existed.
+}
+
+// apply copies the project into the sequencer state.
+// Settings that were given explicitly on the command line take precedence.
+func (p Project) apply() {
+	if !flag.CommandLine.Changed("t") && p.Tempo > 0 {
+		tempo = p.Tempo
+	}
+	if !flag.CommandLine.Changed("l") && p.Steps > 0 {
+		steps = p.Steps
+	}
+	if !flag.CommandLine.Changed("swing") {
+		swing = p.Swing
+	}
+	if !flag.CommandLine.Changed("nd") && p.ND != "" {
+		nd = p.ND
+	}
+	if !flag.CommandLine.Changed("scale") && p.Scale != "" {
+		scaleName = p.Scale
+	}
+	if !flag.CommandLine.Changed("root") && p.Root != "" {
+		rootName = p.Root
+	}
+	if !flag.CommandLine.Changed("kit") && trackPath == "" && p.Kit != "" {
+		_ = setKit(p.Kit) // Checked by loadProject.
+	}
+	bank = p.Bank
+	if p.Slot >= 0 && p.Slot < numSlots {
+		setSlot(p.Slot)
+	}
+	song = p.Song
+}
+
+// length returns the pattern length of the project.
+func (p Project) length() int {
+	if p.Steps < 1 || p.Steps > maxSteps {
+		return maxSteps
+	}
+	return p.Steps
+}
+
+// currentProject returns a snapshot of the sequencer state.
+// It must only be called from the process callback (see snapshot).
+func currentProject() Project {
+	return Project{
+		Tempo: tempo,
+		Steps: steps,
+		Swing: swing,
+		ND:    nd,
+		Scale: scaleName,
+		Root:  rootName,
+		Kit:   kitName,
+		Slot:  slot,
+		Bank:  bank,
+		Song:  song,
+		LFOs:  lfos,
+	}
+}
+
+// loadProject reads a project file and applies it to the sequencer.
+func loadProject(path string) error {
+	p, err := readProject(path)
+	if err != nil {
+		return err
+	}
+	if p.Kit != "" {
+		if _, err := lookupKit(p.Kit); err != nil {
+			return err
+		}
+	}
+	for i, pattern := range p.Bank {
+		if _, err := lookupGroove(pattern.Groove); err != nil {
+			return errors.Wrapf(err, "slot %d", i)
+		}
+		if err := validateResolution(pattern.Resolution); err != nil {
+			return errors.Wrapf(err, "slot %d", i)
+		}
+		if pattern.Program < 0 || pattern.Program > maxProgram {
+			return errors.Errorf("slot %d: program must be from 1 to %d", i, maxProgram)
+		}
+		if pattern.Kit != "" {
+			if _, err := lookupKit(pattern.Kit); err != nil {
+				return errors.Wrapf(err, "slot %d", i)
+			}
+		}
+	}
+	if err := validateSteps(&p.Bank); err != nil {
+		return err
+	}
+	if err := validateLocks(&p.Bank); err != nil {
+		return err
+	}
+	if err := validateVelocities(&p.Bank); err != nil {
+		return err
+	}
+	if err := validatePitches(&p.Bank); err != nil {
+		return err
+	}
+	if err := setLFOs(p.LFOs); err != nil {
+		return err
+	}
+	p.apply()
+	return nil
+}
+
+// validateSteps checks the per-step lanes of the patterns in a bank against the ranges the grid edits them in,
+// so that a hand-edited project can't send invalid MIDI data.
+func validateSteps(b *[numSlots]Pattern) error {
+	for i := range b {
+		p := &b[i]
+		for track := range p.Trigs {
+			if p.Gate[track] > 100 {
+				return errors.Errorf("slot %d track %d: gate must be from 0 to 100", i, track)
+			}
+			for step := range p.Trigs[track] {
+				var msg string
+				switch {
+				case p.Trigs[track][step] > 127:
+					msg = "velocity must be from 0 to 127"
+				case p.Fill[track][step] > 127:
+					msg = "fill velocity must be from 0 to 127"
+				case p.Probability[track][step] > 100:
+					msg = "probability must be from 0 to 100"
+				case p.Conditions[track][step] >= numConditions:
+					msg = fmt.Sprintf("condition must be from 0 to %d", numConditions-1)
+				case p.Ratchets[track][step] > maxRatchets:
+					msg = fmt.Sprintf("ratchets must be from 0 to %d", maxRatchets)
+				case p.MicroTiming[track][step] < -ticksPerStep/2 || p.MicroTiming[track][step] > ticksPerStep/2:
+					msg = fmt.Sprintf("micro-timing must be from %d to %d", -ticksPerStep/2, ticksPerStep/2)
+				case p.Gates[track][step] > 100:
+					msg = "gate must be from 0 to 100"
+				case p.Notes[track][step] > 127:
+					msg = "note must be from 0 to 127"
+				default:
+					continue
+				}
+				return errors.Errorf("slot %d track %d step %d: %s", i, track, step, msg)
+			}
+		}
+	}
+	return nil
+}
+
+// readProject reads a project file.
+// Projects saved before banks existed have their pattern moved to the first slot.
+func readProject(path string) (Project, error) {
+	var p Project
+
+	f, err := os.Open(path)
+	if err != nil {
+		return p, errors.Wrap(err, "opening project file")
+	}
+	defer func() { _ = f.Close() }() // Best effort.
+
+	if err := json.NewDecoder(f).Decode(&p); err != nil {
+		return p, errors.Wrap(err, "decoding project file")
+	}
+	if p.Trigs != nil {
+		p.Bank[0].Trigs = *p.Trigs
+		p.Trigs = nil
+	}
+	return p, nil
+}
+
+// saveProject writes the sequencer state to a project file.
+// It does nothing if path is empty.
+func saveProject(path string) error {
+	if path == "" {
+		return nil
+	}
+	return writeProject(path, snapshot())
+}
+
+// snapshot returns the sequencer state as a Project.
+// The state is copied from inside the process callback so that it never races with playback.
+func snapshot() (p Project) {
+	runInProcess(func() { p = currentProject() })
+	return p
+}
+
+// writeProject writes a project file.
+// The file is replaced atomically so a crash mid-write never loses the previous save.
+func writeProject(path string, p Project) error {
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "encoding project")
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return errors.Wrap(err, "creating temp file")
+	}
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return errors.Wrap(err, "writing project file")
+	}
+	if err := tmp.Close(); err != nil {
+		return errors.Wrap(err, "closing project file")
+	}
+	return errors.Wrap(os.Rename(tmp.Name(), path), "renaming project file")
+}
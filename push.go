@@ -0,0 +1,39 @@
+package main
+
+const (
+	pushPad     = 36 // Note of the Push 2's bottom left pad. The 8 rows of 8 pads follow upwards.
+	pushSide    = 43 // CC of the Push 2's top scene button (1/32t). The ones under it count down.
+	pushEncoder = 71 // CC of the leftmost of the 8 encoders above the Push 2's display.
+	pushPage    = 62 // CC of the Push 2's Page left button. Page right is the next one.
+)
+
+var (
+	// ableton is the manufacturer ID in sysex messages from Ableton devices.
+	ableton = []byte{0x00, 0x21, 0x1D}
+
+	// pushSysex is the start of the Push 2's sysex messages, which is followed by a command byte.
+	pushSysex = []byte{0xF0, 0x00, 0x21, 0x1D, 0x01, 0x01}
+)
+
+// writePushPalette sets the first 16 colors of the Push 2's palette to the green and red brightnesses
+// of the original Launchpad (see ledVelocity), then makes the Push 2 use them.
+func (lp *midiGrid) writePushPalette() int {
+	for g := 0; g < 4; g++ {
+		for r := 0; r < 4; r++ {
+			var (
+				red   = byte(r * 85)
+				green = byte(g * 85)
+			)
+			n := copy(rgbMessage[:], pushSysex)
+			n += copy(rgbMessage[n:], []byte{0x03, byte(4*g + r), red & 0x7F, red >> 7, green & 0x7F, green >> 7, 0, 0, 0, 0, 0xF7})
+
+			if code := lp.write(rgbMessage[:n]); isFailure(code) {
+				return code
+			}
+		}
+	}
+	n := copy(rgbMessage[:], pushSysex)
+	n += copy(rgbMessage[n:], []byte{0x05, 0xF7})
+
+	return lp.write(rgbMessage[:n])
+}
@@ -0,0 +1,56 @@
+package main
+
+const (
+	maxQueued = 256 // Maximum number of messages sent to the Nord Drum in one period.
+)
+
+// queuedEvent is a short MIDI message waiting to be written to the Nord Drum port.
+type queuedEvent struct {
+	time  uint32 // Offset in the period.
+	track int    // Track the message belongs to, -1 for none or clickTrack.
+	size  int
+	data  [3]byte
+}
+
+var (
+	// ndQueue holds the messages for the Nord Drum in the current period, sorted by time.
+	// JACK requires the events in a buffer to be written in time order, so everything
+	// sent to the Nord Drum goes through the queue and is written when the period ends.
+	ndQueue struct {
+		events [maxQueued]queuedEvent
+		n      int
+	}
+)
+
+// flushQueue writes the queued messages to the output ports and empties the queue.
+func flushQueue(outBuffer MidiBuffer) int {
+	defer func() { ndQueue.n = 0 }()
+
+	for i := 0; i < ndQueue.n; i++ {
+		if code := writeEvent(&ndQueue.events[i], outBuffer); isFailure(code) {
+			return code
+		}
+	}
+	return flushUMP()
+}
+
+// queue adds a message for a track (or -1 for none) to the output at an offset in the current period.
+// Messages with the same offset keep the order they were queued in.
+// Messages that don't fit in the queue are dropped, and so are the messages of tracks without a channel,
+// except for note offs, which may end notes played before the track lost its channel.
+func queue(track int, time uint32, data ...byte) {
+	if ndQueue.n == maxQueued || len(data) > 3 {
+		return
+	}
+	if track >= 0 && track < len(trackConfigs) && !trackConfigs[track].assigned() && !noteOff(data) {
+		return
+	}
+	i := ndQueue.n
+	for i > 0 && ndQueue.events[i-1].time > time {
+		ndQueue.events[i] = ndQueue.events[i-1]
+		i--
+	}
+	e := &ndQueue.events[i]
+	e.track, e.time, e.size = track, time, copy(e.data[:], data)
+	ndQueue.n++
+}
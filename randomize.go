@@ -0,0 +1,23 @@
+package main
+
+const (
+	minRandomVelocity = 40 // Lowest velocity given to randomized trigs.
+)
+
+// randomizeTrack replaces a track's trigs with random ones.
+// density is the percentage of steps that get a trig. If velocities is true the trigs
+// get random velocities from minRandomVelocity to 127, otherwise defaultVelocity.
+func randomizeTrack(track, density int, velocities bool) {
+	for step := 0; step < steps; step++ {
+		if !chance(uint8(density)) {
+			trigs[track][step] = 0
+			continue
+		}
+		if velocities {
+			trigs[track][step] = uint8(minRandomVelocity + (rand() % (128 - minRandomVelocity)))
+		} else {
+			trigs[track][step] = defaultVelocity
+		}
+	}
+	gridPainted = false
+}
@@ -0,0 +1,32 @@
+package main
+
+const (
+	maxRatchets = 4 // Maximum number of hits a step can be split into.
+)
+
+// cycleRatchets steps a trig through 1 to maxRatchets hits.
+func cycleRatchets(track, step int) {
+	bank[slot].Ratchets[track][step] = uint8(ratchetCount(track, step)%maxRatchets) + 1
+}
+
+// ratchetCount returns the number of hits a trig is split into.
+func ratchetCount(track, step int) int {
+	if n := bank[slot].Ratchets[track][step]; n > 1 {
+		return int(n)
+	}
+	return 1
+}
+
+// scheduleRatchets schedules the note on and note off of every hit of a trig, the first at offset.
+// The hits are spread evenly over length samples.
+func scheduleRatchets(track, step int, offset, length, nframes uint32, channel, note, velocity byte) {
+	var (
+		n    = uint32(ratchetCount(track, step))
+		gate = gateLength(track, step, length/n)
+	)
+	for i := uint32(0); i < n; i++ {
+		at := offset + ((i * length) / n)
+		later(track, at, nframes, 0x90|channel, note, velocity)
+		later(track, at+gate, nframes, 0x80|channel, note, 0)
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+// recordedHit is a step a track played, kept so incoming notes can be quantized to the nearest step.
+type recordedHit struct {
+	at     int64  // Frame time the step starts at.
+	count  uint64 // Step count of the track's playhead, see stepAt.
+	length uint32 // Number of samples the step lasts.
+}
+
+var (
+	recordInput *Port // JACK port for receiving notes to record.
+	recording   bool  // Flag telling us if notes received on the RecordRecv port are recorded.
+	replacing   bool  // Flag telling us if recording erases each step the playhead passes.
+
+	// recorded flags the steps recorded to since the playhead last passed them,
+	// so that replacing does not erase hits that were played just ahead of their step.
+	recorded [8][maxSteps]bool
+
+	// recordHits holds the last two steps each track played, the latest last.
+	recordHits [8][2]recordedHit
+)
+
+// nearestStep returns the step of a track that starts nearest to a frame time.
+func nearestStep(track int, t int64) int {
+	var (
+		prev = recordHits[track][0]
+		last = recordHits[track][1]
+		half = int64(last.length / 2)
+	)
+	switch {
+	case t >= last.at+half:
+		return stepAt(track, last.count+1)
+	case t >= last.at-half || prev.length == 0:
+		return stepAt(track, last.count)
+	}
+	return stepAt(track, prev.count)
+}
+
+// recordHit remembers a step a track plays, at a frame time.
+func recordHit(track int, count uint64, at int64, length uint32) {
+	recordHits[track][0] = recordHits[track][1]
+	recordHits[track][1] = recordedHit{at: at, count: count, length: length}
+}
+
+// recordNotes records the note ons received on the RecordRecv port into the playing pattern.
+// Each note goes to the track that plays it (see trackFor) on the step nearest to when it was received.
+func recordNotes(nframes uint32, ledBuffer MidiBuffer) int {
+	for _, event := range backend.Events(recordInput, nframes) {
+		in := event.Buffer
+		if !recording || !firstNotePlayed || len(in) < 3 || in[0]&0xF0 != 0x90 || in[2] == 0 {
+			continue
+		}
+		track := trackFor(in[0]&0x0F, in[1])
+		if track < 0 {
+			continue
+		}
+		step := nearestStep(track, int64(frameCount)+int64(event.Time))
+		trigs[track][step] = in[2]
+		recorded[track][step] = true
+
+		if code := lightStep(track, step, ledBuffer); isFailure(code) {
+			return code
+		}
+	}
+	return 0
+}
+
+// replaceStep erases a step the playhead passes while recording in replace mode.
+// Steps recorded to since the playhead last passed them are kept.
+func replaceStep(track, step int, ledBuffer MidiBuffer) int {
+	if !recording || !replacing {
+		return 0
+	}
+	if recorded[track][step] {
+		recorded[track][step] = false
+		return 0
+	}
+	if trigs[track][step] == 0 {
+		return 0
+	}
+	trigs[track][step] = 0
+	return lightStep(track, step, ledBuffer)
+}
+
+// toggleRecording arms or disarms recording.
+func toggleRecording() {
+	recording = !recording
+	recorded = [8][maxSteps]bool{}
+}
+
+// trackFor returns the track a note on a zero-based channel is recorded to, or -1.
+// A track that plays the note on the channel is picked first, then any track on the channel.
+func trackFor(channel, note byte) int {
+	for track, config := range trackConfigs {
+		if config.assigned() && config.channel() == channel && config.Note == note {
+			return track
+		}
+	}
+	for track, config := range trackConfigs {
+		if config.assigned() && config.channel() == channel {
+			return track
+		}
+	}
+	return -1
+}
+
+// recordPad handles a pad press in the seventh row while a top-row button is held.
+// The first pad arms or disarms recording, the second switches between overdub and replace
+// and the last turns the metronome on or off.
+func recordPad(x int) {
+	switch x {
+	case 0:
+		armRecording()
+	case 1:
+		replacing = !replacing
+	case 7:
+		toggleMetronome()
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+var (
+	repeatPulses int     // MIDI clock pulses between the hits of note repeat, or 0 when note repeat is off.
+	repeatHeld   [8]bool // Flags telling us which tracks' pads are held in note repeat.
+)
+
+// repeatRates are the pulses between hits that note repeat can be set to:
+// 1/8, 1/16 and 1/32 notes.
+var repeatRates = [...]int{12, 6, 3}
+
+// holdRepeat handles a pad press or release in note repeat.
+// Each row of the grid repeats its track while any of its pads is held.
+func holdRepeat(track int, pressed bool) {
+	if track >= 0 && track < len(repeatHeld) {
+		repeatHeld[track] = pressed
+	}
+}
+
+// repeatPad handles a pad press in the sixth row while a top-row button is held.
+// Columns 1 to 3 turn note repeat on at 1/8, 1/16 or 1/32 notes and the last column turns it off.
+func repeatPad(x int) {
+	switch {
+	case x < len(repeatRates):
+		repeatPulses = repeatRates[x]
+	case x == gridSize-1:
+		repeatPulses, repeatHeld = 0, [8]bool{}
+	}
+}
+
+// runRepeats plays the hits of note repeat that fall inside the current period.
+// frame is the position of the start of the period, counted from the first beat.
+// Hits fall on the MIDI clock pulses, so they stay in time with the pattern.
+func runRepeats(nframes uint32, frame int64) {
+	if repeatPulses == 0 || samplesPerBeat == 0 {
+		return
+	}
+	end := frame + int64(nframes)
+
+	for n := pulseAt(frame); pulseFrames(n) < end; n++ {
+		t := pulseFrames(n)
+		if t < frame || n%int64(repeatPulses) != 0 {
+			continue
+		}
+		length := uint32(pulseFrames(n+int64(repeatPulses)) - t)
+
+		for track, held := range repeatHeld {
+			if !held || !audible(track) {
+				continue
+			}
+			var (
+				config  = trackConfigs[track]
+				channel = config.channel()
+				note    = quantize(config.Note)
+				offset  = uint32(t - frame)
+			)
+			later(track, offset, nframes, 0x90|channel, note, config.scale(defaultVelocity))
+			later(track, offset+(length*defaultGate)/100, nframes, 0x80|channel, note, 0)
+
+			for _, l := range config.Layers {
+				later(track, offset, nframes, 0x90|l.channel(), l.note(note), config.scale(defaultVelocity))
+				later(track, offset+(length*defaultGate)/100, nframes, 0x80|l.channel(), l.note(note), 0)
+			}
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"github.com/pkg/errors"
+)
+
+var (
+	resolution   string // Note value of a step for patterns that don't set one, e.g. 1/16.
+	stepsPerBeat int64  // Number of steps in a beat at the playing pattern's resolution.
+	stepCount    int64  // Number of steps the sequencer has started.
+	anchorStep   int64  // Index of the step the resolution last changed at.
+	anchorStepAt int64  // Index of the clock pulse that step starts on.
+)
+
+// resolutions are the note values a step can have, with the number of steps in a beat.
+var resolutions = map[string]int64{
+	"1/4":  1,
+	"1/8":  2,
+	"1/16": 4,
+	"1/32": 8,
+}
+
+// anchorSteps makes the first pulse the start of the first step.
+func anchorSteps() {
+	stepCount, anchorStep, anchorStepAt = 0, 0, 0
+}
+
+// pulsesPerStep returns the number of MIDI clock pulses in a step.
+func pulsesPerStep() int64 {
+	return clocksPerBeat / stepsPerBeat
+}
+
+// samplesPerStep returns the rounded number of samples in a step.
+func samplesPerStep() uint32 {
+	return samplesPerBeat / uint32(stepsPerBeat)
+}
+
+// setResolution changes the resolution of the steps to a pattern's, or the default if it has none.
+// Steps after the one being played get the new length, so the playhead doesn't jump.
+func setResolution(name string) {
+	if name == "" {
+		name = resolution
+	}
+	n, ok := resolutions[name]
+	if !ok || n == stepsPerBeat {
+		return
+	}
+	if stepsPerBeat > 0 {
+		next := stepCount + 1
+		anchorStepAt += (next - anchorStep) * pulsesPerStep()
+		anchorStep = next
+	}
+	stepsPerBeat = n
+}
+
+// stepFrames returns the frame step n starts at, counting from the first step.
+func stepFrames(n int64) int64 {
+	return pulseFrames(anchorStepAt + ((n - anchorStep) * pulsesPerStep()))
+}
+
+// stepIndexAt returns the index of the first step that starts at or after a frame.
+func stepIndexAt(frame int64) int64 {
+	n := anchorStep + ((pulseAt(frame) - anchorStepAt) / pulsesPerStep())
+	for stepFrames(n) < frame {
+		n++
+	}
+	return n
+}
+
+// validateResolution checks that a resolution is one of the supported note values.
+// The empty resolution is valid and means the default.
+func validateResolution(name string) error {
+	if _, ok := resolutions[name]; name != "" && !ok {
+		return errors.Errorf("resolution %q must be 1/4, 1/8, 1/16 or 1/32", name)
+	}
+	return nil
+}
@@ -0,0 +1,339 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	rtpVersion      = 2                // AppleMIDI protocol version.
+	rtpPayloadType  = 0x61             // RTP payload type of RTP-MIDI.
+	rtpSyncInterval = 10 * time.Second // Time between the clock syncs an initiator starts, which keep its sessions open.
+)
+
+var (
+	rtpListen string // Address the RTP-MIDI responder listens on, e.g. :5004. Its data port is the next one.
+	rtpInvite string // Address of an RTP-MIDI device or app invited to a session, e.g. 192.168.1.20:5004.
+
+	// rtpEvents hands the messages of the tracks sent over RTP-MIDI from the process callback to serveRTPMIDI.
+	rtpEvents = make(chan queuedEvent, 256)
+
+	// rtpBye asks serveRTPMIDI to end its sessions. It closes the channel it is sent once it has.
+	rtpBye = make(chan chan struct{})
+)
+
+// rtpPacket is a packet received on one of the RTP-MIDI ports.
+type rtpPacket struct {
+	control bool // Flag telling us if the packet came to the control port rather than the data port.
+	data    []byte
+	from    *net.UDPAddr
+}
+
+// rtpPeer is a device or app in a session with ndseq.
+type rtpPeer struct {
+	control, data *net.UDPAddr // Addresses of the peer's control and data ports.
+	ssrc          uint32       // Peer's synchronization source identifier.
+	joined        bool         // Flag telling us if both the control and the data ports have accepted the session.
+}
+
+// rtpSession is the state of ndseq's RTP-MIDI sessions. It is only used by serveRTPMIDI.
+type rtpSession struct {
+	control, data *net.UDPConn
+	peers         []*rtpPeer
+	ssrc          uint32
+	token         uint32 // Initiator token of the invitations ndseq sends.
+	seq           uint16 // Sequence number of the next RTP packet.
+	start         time.Time
+}
+
+// serveRTPMIDI plays the tracks that have rtpmidi set in their track config on network MIDI devices and apps,
+// with the Apple MIDI (RTP-MIDI) session protocol. It accepts the invitations of other peers if --rtp-midi-listen
+// is given, and invites the peer given with --rtp-midi. Messages received from peers are ignored.
+// It does nothing unless one of them is given.
+func serveRTPMIDI() error {
+	if rtpListen == "" && rtpInvite == "" {
+		return nil
+	}
+	now := time.Now()
+	s := &rtpSession{ssrc: uint32(now.UnixNano()), token: uint32(now.UnixNano()>>32) ^ uint32(os.Getpid()), start: now}
+	if err := s.listen(); err != nil {
+		return err
+	}
+	packets := make(chan rtpPacket, 16)
+	go readRTP(s.control, true, packets)
+	go readRTP(s.data, false, packets)
+
+	var invited *net.UDPAddr
+	if rtpInvite != "" {
+		addr, err := net.ResolveUDPAddr("udp", rtpInvite)
+		if err != nil {
+			return errors.Wrap(err, "resolving RTP-MIDI peer address")
+		}
+		invited = addr
+		s.invite(invited)
+	}
+	ticker := time.NewTicker(rtpSyncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case p := <-packets:
+			s.handle(p)
+		case e := <-rtpEvents:
+			s.send(e.data[:e.size])
+		case <-ticker.C:
+			s.sync(invited)
+		case done := <-rtpBye:
+			s.bye()
+			close(done)
+			return nil
+		}
+	}
+}
+
+// listen opens the control and data ports, on consecutive port numbers if --rtp-midi-listen is given
+// and on any free ones otherwise.
+func (s *rtpSession) listen() error {
+	addr := &net.UDPAddr{}
+	if rtpListen != "" {
+		var err error
+		if addr, err = net.ResolveUDPAddr("udp", rtpListen); err != nil {
+			return errors.Wrap(err, "resolving RTP-MIDI listen address")
+		}
+	}
+	control, err := net.ListenUDP("udp", addr)
+	if err != nil {
+		return errors.Wrap(err, "listening on RTP-MIDI control port")
+	}
+	dataAddr := &net.UDPAddr{IP: addr.IP}
+	if addr.Port != 0 {
+		dataAddr.Port = addr.Port + 1
+	}
+	data, err := net.ListenUDP("udp", dataAddr)
+	if err != nil {
+		return errors.Wrap(err, "listening on RTP-MIDI data port")
+	}
+	s.control, s.data = control, data
+	return nil
+}
+
+// readRTP hands the packets received on a port to serveRTPMIDI.
+func readRTP(conn *net.UDPConn, control bool, packets chan<- rtpPacket) {
+	for {
+		buf := make([]byte, 1500)
+		n, from, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "reading RTP-MIDI packet: %s\n", err)
+			return
+		}
+		packets <- rtpPacket{control: control, data: buf[:n], from: from}
+	}
+}
+
+// handle answers a session protocol packet. Packets of other kinds are ignored.
+func (s *rtpSession) handle(p rtpPacket) {
+	if len(p.data) < 4 || p.data[0] != 0xFF || p.data[1] != 0xFF {
+		return
+	}
+	switch cmd := string(p.data[2:4]); cmd {
+	case "IN", "OK", "NO":
+		if len(p.data) < 16 {
+			return
+		}
+		var (
+			token = binary.BigEndian.Uint32(p.data[8:])
+			ssrc  = binary.BigEndian.Uint32(p.data[12:])
+		)
+		s.session(cmd, p, token, ssrc)
+	case "BY":
+		if len(p.data) < 16 {
+			return
+		}
+		s.remove(binary.BigEndian.Uint32(p.data[12:]))
+	case "CK":
+		if len(p.data) < 36 || p.control {
+			return
+		}
+		s.clockSync(p)
+	}
+}
+
+// session handles invitations and the answers to ndseq's.
+// A peer joins a session once both its control and data ports have accepted it.
+func (s *rtpSession) session(cmd string, p rtpPacket, token, ssrc uint32) {
+	if cmd == "NO" {
+		fmt.Fprintf(os.Stderr, "RTP-MIDI peer %s refused the session\n", p.from)
+		return
+	}
+	peer := s.peer(ssrc, p.from)
+	switch {
+	case cmd == "IN" && p.control:
+		peer.control = p.from
+		s.write(s.control, p.from, s.exchange("OK", token))
+	case cmd == "IN":
+		peer.data, peer.joined = p.from, true
+		s.write(s.data, p.from, s.exchange("OK", token))
+		fmt.Printf("RTP-MIDI session with %s\n", peer.control)
+	case cmd == "OK" && p.control:
+		peer.control, peer.data = p.from, &net.UDPAddr{IP: p.from.IP, Port: p.from.Port + 1}
+		s.write(s.data, peer.data, s.exchange("IN", s.token))
+	default: // OK on the data port.
+		peer.data, peer.joined = p.from, true
+		fmt.Printf("RTP-MIDI session with %s\n", peer.control)
+	}
+}
+
+// peer returns the peer with an SSRC, adding it if there isn't one yet.
+func (s *rtpSession) peer(ssrc uint32, from *net.UDPAddr) *rtpPeer {
+	for _, p := range s.peers {
+		if p.ssrc == ssrc {
+			return p
+		}
+	}
+	p := &rtpPeer{ssrc: ssrc, control: from}
+	s.peers = append(s.peers, p)
+	return p
+}
+
+// remove forgets the peer with an SSRC, which has ended its session.
+func (s *rtpSession) remove(ssrc uint32) {
+	for i, p := range s.peers {
+		if p.ssrc == ssrc {
+			s.peers = append(s.peers[:i], s.peers[i+1:]...)
+			fmt.Printf("RTP-MIDI session with %s ended\n", p.control)
+			return
+		}
+	}
+}
+
+// invite asks a peer's control port for a session.
+func (s *rtpSession) invite(addr *net.UDPAddr) {
+	s.write(s.control, addr, s.exchange("IN", s.token))
+}
+
+// sync keeps the sessions open: it starts a clock sync with every peer,
+// and invites the peer given with --rtp-midi again if it isn't in a session.
+func (s *rtpSession) sync(invited *net.UDPAddr) {
+	joined := false
+	for _, p := range s.peers {
+		if !p.joined {
+			continue
+		}
+		s.write(s.data, p.data, s.clock(0, s.now(), 0, 0))
+		joined = joined || (invited != nil && p.control.IP.Equal(invited.IP) && p.control.Port == invited.Port)
+	}
+	if invited != nil && !joined {
+		s.invite(invited)
+	}
+}
+
+// clockSync answers a clock sync packet with the next one of the exchange.
+func (s *rtpSession) clockSync(p rtpPacket) {
+	var (
+		count = p.data[8]
+		ts1   = binary.BigEndian.Uint64(p.data[12:])
+		ts2   = binary.BigEndian.Uint64(p.data[20:])
+	)
+	switch count {
+	case 0:
+		s.write(s.data, p.from, s.clock(1, ts1, s.now(), 0))
+	case 1:
+		s.write(s.data, p.from, s.clock(2, ts1, ts2, s.now()))
+	}
+}
+
+// bye ends every session.
+func (s *rtpSession) bye() {
+	for _, p := range s.peers {
+		msg := make([]byte, 16)
+		copy(msg, []byte{0xFF, 0xFF, 'B', 'Y'})
+		binary.BigEndian.PutUint32(msg[4:], rtpVersion)
+		binary.BigEndian.PutUint32(msg[8:], s.token)
+		binary.BigEndian.PutUint32(msg[12:], s.ssrc)
+		s.write(s.control, p.control, msg)
+	}
+	s.peers = nil
+}
+
+// send sends a MIDI message to every peer in a session with ndseq.
+func (s *rtpSession) send(data []byte) {
+	msg := make([]byte, 13, 13+len(data))
+	msg[0], msg[1] = 0x80, rtpPayloadType
+	binary.BigEndian.PutUint16(msg[2:], s.seq)
+	binary.BigEndian.PutUint32(msg[4:], uint32(s.now()))
+	binary.BigEndian.PutUint32(msg[8:], s.ssrc)
+	msg[12] = byte(len(data)) // Short MIDI command section header: no journal, no delta time.
+	msg = append(msg, data...)
+	s.seq++
+
+	for _, p := range s.peers {
+		if p.joined {
+			s.write(s.data, p.data, msg)
+		}
+	}
+}
+
+// exchange returns a session exchange packet: an invitation (IN) or its acceptance (OK).
+func (s *rtpSession) exchange(cmd string, token uint32) []byte {
+	msg := make([]byte, 16, 16+len(clientName)+1)
+	copy(msg, []byte{0xFF, 0xFF, cmd[0], cmd[1]})
+	binary.BigEndian.PutUint32(msg[4:], rtpVersion)
+	binary.BigEndian.PutUint32(msg[8:], token)
+	binary.BigEndian.PutUint32(msg[12:], s.ssrc)
+	return append(append(msg, clientName...), 0)
+}
+
+// clock returns a clock sync packet with the timestamps of the exchange so far.
+func (s *rtpSession) clock(count byte, ts1, ts2, ts3 uint64) []byte {
+	msg := make([]byte, 36)
+	copy(msg, []byte{0xFF, 0xFF, 'C', 'K'})
+	binary.BigEndian.PutUint32(msg[4:], s.ssrc)
+	msg[8] = count
+	binary.BigEndian.PutUint64(msg[12:], ts1)
+	binary.BigEndian.PutUint64(msg[20:], ts2)
+	binary.BigEndian.PutUint64(msg[28:], ts3)
+	return msg
+}
+
+// now returns the time since the sessions started, in the 100 microsecond units of RTP-MIDI timestamps.
+func (s *rtpSession) now() uint64 {
+	return uint64(time.Since(s.start) / (100 * time.Microsecond))
+}
+
+// write sends a packet to a peer, logging the failures.
+func (s *rtpSession) write(conn *net.UDPConn, to *net.UDPAddr, msg []byte) {
+	if _, err := conn.WriteToUDP(msg, to); err != nil {
+		fmt.Fprintf(os.Stderr, "writing RTP-MIDI packet: %s\n", err)
+	}
+}
+
+// sendRTP hands a message of a track sent over RTP-MIDI to serveRTPMIDI.
+// It is called from the process callback, so the message is dropped if serveRTPMIDI falls behind.
+func sendRTP(e *queuedEvent) {
+	select {
+	case rtpEvents <- *e:
+	default:
+	}
+}
+
+// endRTPSessions tells the peers that ndseq is leaving its sessions, waiting a second at most.
+func endRTPSessions() {
+	if rtpListen == "" && rtpInvite == "" {
+		return
+	}
+	done := make(chan struct{})
+	select {
+	case rtpBye <- done:
+	case <-time.After(time.Second):
+		return
+	}
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+	}
+}
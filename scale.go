@@ -0,0 +1,117 @@
+package main
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const chromatic = "chromatic" // Scale that leaves notes unchanged.
+
+var (
+	scaleName = chromatic // Name of the scale notes are quantized to.
+	rootName  = "C"       // Name of the scale's root note.
+	scale     []uint8     // Semitones of the scale above the root. Nil when notes are not quantized.
+	root      uint8       // Pitch class of the root, from 0 (C) to 11 (B).
+)
+
+// scales are the scales notes can be quantized to, in semitones above the root.
+var scales = map[string][]uint8{
+	chromatic:          nil,
+	"major":            {0, 2, 4, 5, 7, 9, 11},
+	"minor":            {0, 2, 3, 5, 7, 8, 10},
+	"dorian":           {0, 2, 3, 5, 7, 9, 10},
+	"phrygian":         {0, 1, 3, 5, 7, 8, 10},
+	"lydian":           {0, 2, 4, 6, 7, 9, 11},
+	"mixolydian":       {0, 2, 4, 5, 7, 9, 10},
+	"locrian":          {0, 1, 3, 5, 6, 8, 10},
+	"pentatonic":       {0, 2, 4, 7, 9},
+	"minor-pentatonic": {0, 3, 5, 7, 10},
+	"blues":            {0, 3, 5, 6, 7, 10},
+}
+
+// pitchClasses are the names of the root notes, indexed by pitch class.
+var pitchClasses = [12]string{"C", "C#", "D", "D#", "E", "F", "F#", "G", "G#", "A", "A#", "B"}
+
+// inScale reports whether a note belongs to the scale.
+func inScale(note uint8) bool {
+	if scale == nil {
+		return true
+	}
+	degree := (note + 12 - root) % 12
+	for _, interval := range scale {
+		if interval == degree {
+			return true
+		}
+	}
+	return false
+}
+
+// quantize returns the nearest note of the scale, preferring the lower one of two equally near notes.
+func quantize(note uint8) uint8 {
+	for d := uint8(0); d < 12; d++ {
+		if note >= d && inScale(note-d) {
+			return note - d
+		}
+		if note+d <= 0x7F && inScale(note+d) {
+			return note + d
+		}
+	}
+	return note
+}
+
+// scaleNames returns the names of the scales in alphabetical order.
+func scaleNames() []string {
+	names := make([]string, 0, len(scales))
+	for name := range scales {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// setScale validates and sets the scale and root notes are quantized to.
+// The root is a note name such as C, F# or Bb.
+func setScale(name, rootNote string) error {
+	intervals, ok := scales[name]
+	if !ok {
+		return errors.Errorf("unknown scale %q (want one of %s)", name, strings.Join(scaleNames(), ", "))
+	}
+	pc, ok := pitchClass(rootNote)
+	if !ok {
+		return errors.Errorf("invalid root note %q", rootNote)
+	}
+	scaleName, rootName = name, rootNote
+	scale, root = intervals, pc
+	return nil
+}
+
+// pitchClass parses a note name such as C, F# or Bb.
+func pitchClass(name string) (uint8, bool) {
+	if name == "" {
+		return 0, false
+	}
+	var (
+		letter = strings.ToUpper(name[:1])
+		pc     = -1
+	)
+	for i, n := range pitchClasses {
+		if n == letter {
+			pc = i
+		}
+	}
+	if pc < 0 {
+		return 0, false
+	}
+	switch name[1:] {
+	case "":
+	case "#":
+		pc++
+	case "b":
+		pc--
+	default:
+		return 0, false
+	}
+	return uint8((pc + 12) % 12), true
+}
@@ -0,0 +1,87 @@
+package main
+
+const (
+	maxPending = 1024 // Maximum number of messages scheduled for later periods.
+)
+
+// scheduledEvent is a short MIDI message waiting for the period it is due in.
+type scheduledEvent struct {
+	at    uint64 // Frame time the message is due at.
+	track int    // Track the message belongs to, -1 for none or clickTrack.
+	size  int
+	data  [3]byte
+}
+
+var (
+	lookahead int // Milliseconds ahead of the current period that steps are decided.
+
+	// pending holds messages for the outputs that are due in a later period,
+	// such as ratchet hits, note offs, late or early trigs, and steps decided ahead.
+	// What plays is decided when a step starts (or up to lookahead before) and
+	// the messages are written into the buffer of the period they fall in.
+	pending struct {
+		events [maxPending]scheduledEvent
+		n      int
+	}
+)
+
+// later schedules a message for a track at an offset from the start of the current period.
+func later(track int, offset uint32, nframes uint32, data ...byte) {
+	schedule(track, frameCount+uint64(offset), nframes, data...)
+}
+
+// lookaheadFrames returns the number of frames ahead of the current period that steps are decided.
+func lookaheadFrames() uint64 {
+	return (uint64(lookahead) * uint64(sampleRate)) / 1000
+}
+
+// playPending queues the scheduled messages that are due in the current period.
+// Messages for tracks that have been muted since they were scheduled are dropped,
+// except for note offs, which are still needed to end the notes that were played.
+func playPending(nframes uint32) {
+	var (
+		end = frameCount + uint64(nframes)
+		n   = 0
+	)
+	for i := 0; i < pending.n; i++ {
+		e := pending.events[i]
+		if !audible(e.track) && !noteOff(e.data[:e.size]) {
+			continue
+		}
+		if e.at < end {
+			queue(e.track, uint32(e.at-frameCount), e.data[:e.size]...)
+			continue
+		}
+		pending.events[n] = e
+		n++
+	}
+	pending.n = n
+}
+
+// schedule schedules a message for a track at a frame time, which must not be
+// before the current period. Messages due in the current period are queued right away.
+// Messages that don't fit are dropped.
+func schedule(track int, at uint64, nframes uint32, data ...byte) {
+	if at < frameCount+uint64(nframes) {
+		queue(track, uint32(at-frameCount), data...)
+		return
+	}
+	if pending.n == maxPending || len(data) > 3 {
+		return
+	}
+	e := &pending.events[pending.n]
+	e.at, e.track, e.size = at, track, copy(e.data[:], data)
+	pending.n++
+}
+
+// releaseNotes queues the scheduled note offs at the start of the current period and drops the other
+// scheduled messages, so that no note is left hanging when ndseq exits.
+// It must only be called from the process callback.
+func releaseNotes() {
+	for i := 0; i < pending.n; i++ {
+		if e := &pending.events[i]; noteOff(e.data[:e.size]) {
+			queue(e.track, 0, e.data[:e.size]...)
+		}
+	}
+	pending.n = 0
+}
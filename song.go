@@ -0,0 +1,108 @@
+package main
+
+import (
+	"github.com/pkg/errors"
+)
+
+// SongEntry plays a pattern from the bank a number of times,
+// optionally changing the tempo when it starts.
+type SongEntry struct {
+	Slot   int     `json:"slot"`            // Bank slot, from 0 to 7.
+	Repeat int     `json:"repeat"`          // Number of times the pattern is played. Zero plays it once.
+	Tempo  float64 `json:"tempo,omitempty"` // Tempo to change to in BPM. Zero keeps the tempo.
+	Ramp   int     `json:"ramp,omitempty"`  // Number of bars (pattern loops) the tempo ramps over. Zero jumps to it.
+}
+
+// repeats returns the number of times the entry's pattern is played.
+func (e SongEntry) repeats() int {
+	if e.Repeat < 1 {
+		return 1
+	}
+	return e.Repeat
+}
+
+var (
+	song       []SongEntry // Chain of patterns played in song mode.
+	songMode   bool        // Flag telling us if the song drives pattern switching.
+	songPos    int         // Index of the playing song entry.
+	songRepeat int         // Number of times the playing entry's pattern has finished.
+
+	rampFrom  float64 // Tempo the playing tempo ramp started from.
+	rampTo    float64 // Tempo the playing tempo ramp ends at.
+	rampSteps int     // Number of steps the playing tempo ramp lasts. Zero when no ramp is playing.
+	rampPos   int     // Number of steps of the playing tempo ramp that have been played.
+)
+
+// advanceSong queues the next pattern of the song.
+// It is called each time the playing pattern finishes.
+// The song starts over after its last entry.
+func advanceSong() {
+	if !songMode || len(song) == 0 {
+		return
+	}
+	songRepeat++
+
+	if songRepeat >= song[songPos].repeats() {
+		songRepeat = 0
+		songPos = (songPos + 1) % len(song)
+		startTempo()
+	}
+	nextSlot = song[songPos].Slot
+}
+
+// rampTempo moves the tempo one step further along the playing tempo ramp.
+// It is called on every step.
+func rampTempo() {
+	if rampSteps == 0 {
+		return
+	}
+	rampPos++
+	tempoNext = rampFrom + ((rampTo - rampFrom) * float64(rampPos) / float64(rampSteps))
+
+	if rampPos >= rampSteps {
+		rampSteps = 0
+	}
+}
+
+// startSong validates the song and makes its first pattern the playing one.
+func startSong() error {
+	if len(song) == 0 {
+		return errors.New("song is empty")
+	}
+	for i, e := range song {
+		if e.Slot < 0 || e.Slot >= numSlots {
+			return errors.Errorf("song entry %d: slot must be between 0 and %d", i, numSlots-1)
+		}
+		if e.Tempo == 0 {
+			continue
+		}
+		if err := validateTempo(e.Tempo); err != nil {
+			return errors.Wrapf(err, "song entry %d", i)
+		}
+		if e.Ramp < 0 {
+			return errors.Errorf("song entry %d: ramp must not be negative", i)
+		}
+	}
+	songPos, songRepeat = 0, 0
+	setSlot(song[0].Slot)
+	startTempo()
+	return nil
+}
+
+// startTempo changes the tempo to the playing entry's, right away or by starting a ramp.
+func startTempo() {
+	e := song[songPos]
+	if e.Tempo == 0 {
+		rampSteps = 0
+		return
+	}
+	if e.Ramp == 0 {
+		rampSteps, tempoNext = 0, e.Tempo
+		return
+	}
+	rampFrom = tempo
+	if tempoNext != 0 {
+		rampFrom = tempoNext
+	}
+	rampTo, rampSteps, rampPos = e.Tempo, e.Ramp*steps, 0
+}
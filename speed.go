@@ -0,0 +1,119 @@
+package main
+
+import (
+	"github.com/pkg/errors"
+)
+
+// Speed is a track's playback rate relative to the master step clock, as a power of two.
+// The zero Speed plays one step per master step.
+type Speed int8
+
+// Speeds from a quarter to four times the master step clock.
+const (
+	speedQuarter Speed = iota - 2
+	speedHalf
+	speedNormal
+	speedDouble
+	speedQuadruple
+)
+
+const (
+	posPerStep = 8 // Units of a track's playhead position per track step, see trackPos.
+)
+
+var (
+	// trackPos is the playhead position of each track in eighths of a track step,
+	// which is fine enough for every speed with or without triplets to advance
+	// by a whole number of units per master step.
+	trackPos [8]uint64
+)
+
+// advance returns the number of eighths of a track step a track moves in a master step.
+// Triplet tracks play three steps in the time of two.
+func advance(track int) uint64 {
+	var (
+		s = bank[slot].Speed[track]
+		n = uint64(posPerStep)
+	)
+	if s > speedNormal {
+		n <<= uint(s)
+	} else {
+		n >>= uint(-s)
+	}
+	if bank[slot].Triplet[track] {
+		n = (n * 3) / 2
+	}
+	return n
+}
+
+// MarshalText encodes the speed as "1/4x", "1/2x", "1x", "2x" or "4x".
+func (s Speed) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// String returns the text form of the speed.
+func (s Speed) String() string {
+	switch s {
+	case speedQuarter:
+		return "1/4x"
+	case speedHalf:
+		return "1/2x"
+	case speedDouble:
+		return "2x"
+	case speedQuadruple:
+		return "4x"
+	}
+	return "1x"
+}
+
+// UnmarshalText decodes a speed encoded by MarshalText.
+func (s *Speed) UnmarshalText(text []byte) error {
+	for candidate := speedQuarter; candidate <= speedQuadruple; candidate++ {
+		if candidate.String() == string(text) {
+			*s = candidate
+			return nil
+		}
+	}
+	if len(text) == 0 {
+		*s = speedNormal
+		return nil
+	}
+	return errors.Errorf("unknown track speed %q", string(text))
+}
+
+// advanceTrack moves a track's playhead past the steps it played in a master step.
+func advanceTrack(track int) {
+	trackPos[track] += advance(track)
+}
+
+// locatePlayheads moves every track to where it is after a number of master steps.
+func locatePlayheads(masterSteps uint64) {
+	for track := range trackPos {
+		trackPos[track] = masterSteps * advance(track)
+	}
+}
+
+// resetPlayheads moves every track back to the first step.
+func resetPlayheads() {
+	trackPos = [8]uint64{}
+}
+
+// toggleTriplet switches a track between straight and triplet steps.
+func toggleTriplet(track int) {
+	bank[slot].Triplet[track] = !bank[slot].Triplet[track]
+}
+
+// trackHits returns the step count of the first step a track plays in the next master step,
+// how many steps it plays, the offset of the first one in samples, and the number of samples
+// each of its steps lasts. n is zero if a slow track does not play in the next master step.
+func trackHits(track int, length uint32) (first uint64, n int, start, stepSamples uint32) {
+	var (
+		pos = trackPos[track]
+		adv = advance(track)
+		end = (pos + adv + posPerStep - 1) / posPerStep // First step that starts after the master step.
+	)
+	first = (pos + posPerStep - 1) / posPerStep
+	start = uint32(((first*posPerStep - pos) * uint64(length)) / adv)
+	stepSamples = uint32((posPerStep * uint64(length)) / adv)
+	return first, int(end - first), start, stepSamples
+}
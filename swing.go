@@ -0,0 +1,51 @@
+package main
+
+import (
+	"github.com/pkg/errors"
+)
+
+var (
+	swing   int    // Swing amount in percent. 100 delays every other step by half a step.
+	stepLen uint32 // Number of samples between the last step and the next one.
+)
+
+// setSwing validates and sets the swing amount.
+func setSwing(amount int) error {
+	if amount < 0 || amount > 100 {
+		return errors.New("swing must be between 0 and 100")
+	}
+	swing = amount
+	return nil
+}
+
+// swingPulses returns the number of MIDI clock pulses a step is delayed by.
+func swingPulses(step int) int {
+	if step%2 == 0 {
+		return 0
+	}
+	return (swing * int(pulsesPerStep())) / 200
+}
+
+// stepDelay returns the number of samples a step is offset from the straight grid
+// by swing and the playing pattern's groove.
+// Swing delays every odd step, so pairs of steps keep their total length.
+func stepDelay(step int) int64 {
+	var d int64
+	if step%2 == 1 {
+		d = (int64(samplesPerStep()/2) * int64(swing)) / 100
+	}
+	return d + groove.delay(step)
+}
+
+// stepLength returns the number of samples from the start of step to the next one,
+// which is the stepCount'th step the sequencer has started.
+func stepLength(step int) uint32 {
+	var (
+		next = nextBeat(step)
+		n    = stepFrames(stepCount+1) - stepFrames(stepCount) + stepDelay(next) - stepDelay(step)
+	)
+	if n < 1 {
+		return 1
+	}
+	return uint32(n)
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"github.com/pkg/errors"
+)
+
+const (
+	syncExternal = "external" // Follow MIDI clock received on the ClockRecv port.
+	syncInternal = "internal" // Run from the internal tempo.
+
+	midiContinue = 0xFB // MIDI continue.
+
+	// Weight of the latest pulse interval when smoothing the external tempo.
+	pulseSmoothing = 0.1
+)
+
+var (
+	syncMode   string // How steps are clocked, one of syncInternal or syncExternal.
+	clockInput *Port  // JACK port for receiving MIDI clock from an external master.
+
+	extRunning   bool    // Flag telling us if the external master has sent start or continue.
+	extPulses    int     // Pulses received since the last step, always less than a step's pulses.
+	extLastPulse uint64  // Frame time of the last pulse. Zero until the first pulse arrives.
+	extInterval  float64 // Smoothed number of samples between pulses.
+)
+
+// followClock advances the sequencer from the MIDI clock received on the ClockRecv port.
+// A step is triggered every pulsesPerStep pulses while the master is running.
+// Incoming realtime messages are forwarded to the Nord Drum if clock output is enabled.
+func followClock(nframes uint32, ledBuffer MidiBuffer) int {
+	for _, event := range backend.Events(clockInput, nframes) {
+		if len(event.Buffer) != 1 {
+			continue
+		}
+		switch event.Buffer[0] {
+		case midiStart:
+			beat, extPulses, extRunning = 0, 0, true
+			resetPlayheads()
+			firstNotePlayed = false
+		case midiContinue:
+			extRunning = true
+		case midiStop:
+			extRunning = false
+		case midiClock:
+			measurePulse(frameCount + uint64(event.Time))
+
+			if extRunning && extPulses == swingPulses(beat) {
+				stepLen = samplesPerStep()
+				code := trigger(event.Time, nframes, ledBuffer)
+				firstNotePlayed = true
+				if isFailure(code) {
+					return code
+				}
+			}
+			if extRunning {
+				extPulses = (extPulses + 1) % int(pulsesPerStep())
+			}
+		default:
+			continue
+		}
+		if clockOut {
+			queue(-1, event.Time, event.Buffer[0])
+		}
+	}
+	return 0
+}
+
+// measurePulse updates the tempo from the time between two clock pulses.
+func measurePulse(t uint64) {
+	if extLastPulse == 0 || t <= extLastPulse {
+		extLastPulse = t
+		return
+	}
+	interval := float64(t - extLastPulse)
+	extLastPulse = t
+
+	if extInterval == 0 {
+		extInterval = interval
+	} else {
+		extInterval += pulseSmoothing * (interval - extInterval)
+	}
+	samplesPerBeat = uint32(extInterval * clocksPerBeat)
+
+	if samplesPerBeat > 0 {
+		tempo = (60 * float64(sampleRate)) / float64(samplesPerBeat)
+	}
+}
+
+// validateSync checks the --sync flag.
+func validateSync() error {
+	switch syncMode {
+	case syncInternal, syncExternal, syncTransport:
+		return nil
+	}
+	return errors.Errorf("sync must be %q, %q or %q", syncInternal, syncExternal, syncTransport)
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	flag "github.com/spf13/pflag"
+)
+
+const (
+	sysexStart  = 0xF0                   // First byte of a sysex message.
+	sysexEnd    = 0xF7                   // Last byte of a sysex message.
+	sysexGap    = 100 * time.Millisecond // Time between restored messages, so the Nord Drum can store each one.
+	dumpWait    = time.Minute            // Time the dump waits for the Nord Drum to start sending.
+	dumpSilence = 2 * time.Second        // Time without messages after which a dump is complete.
+)
+
+// Usage of the flags the dump and restore subcommands take like the sequencer does.
+const (
+	ndUsage         = "JACK ports of the Nord Drum 3p: part of their name, /regexp/ or =exact:name, separated by commas."
+	profileUsage    = "YAML or TOML device profile describing the output device."
+	clientNameUsage = "JACK client name, so that several ndseqs can run side by side."
+	serverUsage     = "Name of the JACK server to connect to, instead of the default one."
+	backendUsage    = "How MIDI devices are reached: jack, or alsa for the ALSA sequencer on Linux."
+)
+
+var (
+	librarian   Backend   // Backend of the librarian's client.
+	sysexInput  = &Port{} // JACK port for receiving dumps from the Nord Drum.
+	sysexOutput = &Port{} // JACK port for sending requests and dumps to the Nord Drum.
+
+	dumpRequest  []byte      // Message sent to ask the Nord Drum for a dump, or nil.
+	dumpReceived chan []byte // Sysex messages received while dumping.
+
+	restoreQueue [][]byte      // Sysex messages sent while restoring.
+	restoreNext  int           // Index of the next message to restore.
+	restoreGap   uint32        // Frames between restored messages.
+	restoreWait  uint32        // Frames left until the next message is restored.
+	restoreDone  chan struct{} // Closed when every message has been restored.
+	restoreOnce  sync.Once
+)
+
+// dumpCommand receives program dumps from the Nord Drum and stores them in a .syx file.
+// Start the dump from the Nord Drum, or give the sysex message that requests one in hex.
+func dumpCommand(args []string) error {
+	args, err := parseLibrarianFlags(args)
+	if err != nil {
+		return err
+	}
+	if len(args) != 1 && len(args) != 2 {
+		return errors.New("usage: ndseq dump [--nd PATTERN] [--profile FILE] [--client-name NAME] [--server NAME] [--backend jack|alsa] FILE [REQUEST]")
+	}
+	if len(args) == 2 {
+		req, err := hex.DecodeString(args[1])
+		if err != nil || len(splitSysex(req)) != 1 {
+			return errors.New("REQUEST must be one sysex message in hex, e.g. F0...F7")
+		}
+		dumpRequest = req
+	}
+	dumpReceived = make(chan []byte, 256)
+
+	if err := openLibrarian(dumpProcess); err != nil {
+		return err
+	}
+	defer func() { _ = librarian.Close() }() // Best effort.
+
+	var (
+		data    []byte
+		timeout = time.After(dumpWait)
+	)
+	fmt.Fprintln(os.Stderr, "waiting for the Nord Drum to send its programs")
+	for {
+		select {
+		case msg := <-dumpReceived:
+			data = append(data, msg...)
+			timeout = time.After(dumpSilence)
+			continue
+		case <-timeout:
+		}
+		break
+	}
+	if len(data) == 0 {
+		return errors.New("no sysex received")
+	}
+	fmt.Fprintf(os.Stderr, "received %d messages\n", len(splitSysex(data)))
+	return errors.Wrap(os.WriteFile(args[0], data, 0644), "writing dump")
+}
+
+// dumpProcess sends the dump request, if any, and collects the sysex messages received.
+func dumpProcess(nframes uint32) int {
+	buf := librarian.Buffer(sysexOutput, nframes)
+	if dumpRequest != nil {
+		if code := librarian.Write(sysexOutput, &MidiEvent{Buffer: dumpRequest}, buf); isFailure(code) {
+			return code
+		}
+		dumpRequest = nil
+	}
+	for _, event := range librarian.Events(sysexInput, nframes) {
+		if len(event.Buffer) == 0 || event.Buffer[0] != sysexStart {
+			continue
+		}
+		select {
+		case dumpReceived <- append([]byte(nil), event.Buffer...):
+		default: // Dropped.
+		}
+	}
+	return 0
+}
+
+// parseLibrarianFlags parses the flags of the dump and restore subcommands, returning their other arguments.
+// The Nord Drum's ports are matched and the JACK server is chosen from them as they are by the sequencer.
+func parseLibrarianFlags(args []string) ([]string, error) {
+	flag.StringVar(&nd, "nd", defaultND, ndUsage)
+	flag.StringVar(&profilePath, "profile", "", profileUsage)
+	flag.StringVar(&clientName, "client-name", clientName, clientNameUsage)
+	flag.StringVar(&serverName, "server", "", serverUsage)
+	flag.StringVar(&backendName, "backend", backendJACK, backendUsage)
+	if err := flag.CommandLine.Parse(args); err != nil {
+		return nil, err
+	}
+	if err := loadProfile(profilePath); err != nil {
+		return nil, errors.Wrap(err, "loading profile")
+	}
+	if err := setMatchers(); err != nil {
+		return nil, err
+	}
+	if err := validateBackend(); err != nil {
+		return nil, err
+	}
+	if err := useServer(); err != nil {
+		return nil, err
+	}
+	return flag.Args(), nil
+}
+
+// openLibrarian opens a client with ports connected to the Nord Drum, for dumping and restoring.
+// The bytes received are parsed into complete messages, as they are for the sequencer.
+func openLibrarian(process func(nframes uint32) int) error {
+	librarian = parserBackend{newBackend()}
+
+	if err := librarian.Open(clientName+"-librarian", Callbacks{}); err != nil {
+		return err
+	}
+	if err := setupLibrarian(process); err != nil {
+		_ = librarian.Close() // Best effort.
+		return err
+	}
+	return nil
+}
+
+// setupLibrarian registers the ports of the librarian's client, starts it and connects it to the Nord Drum.
+func setupLibrarian(process func(nframes uint32) int) error {
+	if err := librarian.Register("NordDrumRecv", sysexInput, false); err != nil {
+		return err
+	}
+	if err := librarian.Register("NordDrumSend", sysexOutput, true); err != nil {
+		return err
+	}
+	restoreGap = uint32((time.Duration(librarian.SampleRate()) * sysexGap) / time.Second)
+
+	if err := librarian.Start(process); err != nil {
+		return err
+	}
+	matches := Ports.Outputs["NordDrumSend"].Matches
+
+	for _, name := range librarian.Devices(true) {
+		if matches(name) {
+			if err := errors.Wrapf(librarian.Connect(sysexOutput, name), "connecting to %s", name); err != nil {
+				return err
+			}
+		}
+	}
+	for _, name := range librarian.Devices(false) {
+		if matches(name) {
+			if err := errors.Wrapf(librarian.Connect(sysexInput, name), "connecting %s", name); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// restoreCommand sends the program dumps stored in a .syx file back to the Nord Drum.
+func restoreCommand(args []string) error {
+	args, err := parseLibrarianFlags(args)
+	if err != nil {
+		return err
+	}
+	if len(args) != 1 {
+		return errors.New("usage: ndseq restore [--nd PATTERN] [--profile FILE] [--client-name NAME] [--server NAME] [--backend jack|alsa] FILE")
+	}
+	data, err := os.ReadFile(args[0])
+	if err != nil {
+		return errors.Wrap(err, "reading dump")
+	}
+	if restoreQueue = splitSysex(data); len(restoreQueue) == 0 {
+		return errors.New("no sysex in dump")
+	}
+	restoreDone = make(chan struct{})
+
+	if err := openLibrarian(restoreProcess); err != nil {
+		return err
+	}
+	defer func() { _ = librarian.Close() }() // Best effort.
+
+	<-restoreDone
+	time.Sleep(sysexGap) // Let the last message leave the buffer.
+	fmt.Fprintf(os.Stderr, "sent %d messages\n", len(restoreQueue))
+	return nil
+}
+
+// restoreProcess sends the next message of the dump being restored every sysexGap.
+func restoreProcess(nframes uint32) int {
+	buf := librarian.Buffer(sysexOutput, nframes)
+
+	if restoreWait > nframes {
+		restoreWait -= nframes
+		return 0
+	}
+	if restoreNext == len(restoreQueue) {
+		restoreOnce.Do(func() { close(restoreDone) })
+		return 0
+	}
+	if code := librarian.Write(sysexOutput, &MidiEvent{Buffer: restoreQueue[restoreNext]}, buf); isFailure(code) {
+		return code
+	}
+	restoreNext++
+	restoreWait = restoreGap
+	return 0
+}
+
+// splitSysex splits data into its sysex messages. Bytes outside a message are skipped.
+func splitSysex(data []byte) [][]byte {
+	var msgs [][]byte
+
+	for {
+		start := bytes.IndexByte(data, sysexStart)
+		if start < 0 {
+			return msgs
+		}
+		end := bytes.IndexByte(data[start:], sysexEnd)
+		if end < 0 {
+			return msgs
+		}
+		msgs = append(msgs, data[start:start+end+1])
+		data = data[start+end+1:]
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"math"
+)
+
+const (
+	maxTaps    = 4 // Number of intervals between taps that are averaged.
+	tapTimeout = 2 // Seconds after which a tap starts a new count.
+)
+
+var (
+	tapNote  int    // Note received on the NordDrumRecv port that taps the tempo, or -1.
+	tapLast  uint64 // Frame time of the last tap. Zero before the first one.
+	tapTimes [maxTaps]uint64
+	tapCount int // Number of intervals in tapTimes, at most maxTaps.
+)
+
+// tap handles a tap at a frame time.
+// The tempo changes to the average of the intervals between the last maxTaps+1 taps.
+// A tap more than tapTimeout seconds after the previous one starts counting again.
+// It must only be called from the process callback.
+func tap(at uint64) {
+	if tapLast == 0 || at <= tapLast || at-tapLast > tapTimeout*uint64(sampleRate) {
+		tapLast, tapCount = at, 0
+		return
+	}
+	copy(tapTimes[1:], tapTimes[:maxTaps-1])
+	tapTimes[0] = at - tapLast
+	tapLast = at
+	if tapCount < maxTaps {
+		tapCount++
+	}
+	var total uint64
+	for _, interval := range tapTimes[:tapCount] {
+		total += interval
+	}
+	bpm := math.Round((600*float64(sampleRate)*float64(tapCount))/float64(total)) / 10
+
+	// The tapped tempo replaces any change still pending in tempoNext rather than adding to it.
+	_ = setTempo(bpm) // Tempos out of range are ignored.
+}
+
+// tapControl handles a note on received on the NordDrumRecv port, which taps the tempo if it is tapNote.
+func tapControl(in []byte, at uint64) {
+	if len(in) < 3 || in[0]&0xF0 != 0x90 || in[2] == 0 || int(in[1]) != tapNote {
+		return
+	}
+	tap(at)
+}
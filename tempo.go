@@ -0,0 +1,137 @@
+package main
+
+import (
+	"math"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	minTempo = 20  // Slowest tempo in BPM.
+	maxTempo = 300 // Fastest tempo in BPM.
+
+	tempoCoarse = 1   // BPM added or removed by the coarse tempo pads.
+	tempoFine   = 0.1 // BPM added or removed by the fine tempo pads.
+)
+
+var (
+	tempoCC     int     // CC received on the NordDrumRecv port that sets the tempo, or -1.
+	tempoNext   float64 // Tempo to change to at the start of the next period, or 0.
+	anchorFrame int64   // Frame of the clock pulse the tempo last changed at.
+	anchorPulse int64   // Index of the clock pulse the tempo last changed at.
+)
+
+// anchorTempo makes a frame the position of the first beat.
+func anchorTempo(frame int64) {
+	anchorFrame, anchorPulse = frame, 0
+}
+
+// applyTempo changes to the next tempo, if one was set, at the start of a period.
+// frame is the position of the start of the period. The pulses up to the first one
+// in the period keep the old tempo and the pulses from it on get the new one,
+// so the clock and the steps change speed without jumping.
+func applyTempo(frame int64) {
+	if tempoNext == 0 || tempoNext == tempo {
+		tempoNext = 0
+		return
+	}
+	n := pulseAt(frame)
+	if pulseFrames(n) < frame {
+		n++
+	}
+	anchorFrame, anchorPulse = pulseFrames(n), n
+	tempo, tempoNext = tempoNext, 0
+	setSamplesPerBeat(sampleRate)
+}
+
+// changeTempo changes the tempo by a number of BPM, limited to minTempo-maxTempo.
+// It must only be called from the process callback.
+func changeTempo(delta float64) {
+	bpm := tempo
+	if tempoNext != 0 {
+		bpm = tempoNext
+	}
+	bpm = math.Round((bpm+delta)*10) / 10
+	tempoNext = math.Max(minTempo, math.Min(maxTempo, bpm))
+}
+
+// millitempo returns the tempo in thousandths of a BPM.
+// Beat and clock positions are computed from it with integer math so they are exact.
+func millitempo() int64 {
+	return int64(math.Round(tempo * 1000))
+}
+
+// pulseAt returns the index of the last clock pulse at or before a frame.
+func pulseAt(frame int64) int64 {
+	var (
+		num = (frame - anchorFrame) * clocksPerBeat * millitempo()
+		den = 60000 * int64(sampleRate)
+		n   = num / den
+	)
+	if num%den != 0 && num < 0 {
+		n-- // Round towards negative infinity.
+	}
+	n += anchorPulse
+	for pulseFrames(n) > frame {
+		n--
+	}
+	return n
+}
+
+// pulseFrames returns the frame MIDI clock pulse n falls on.
+// Pulses are placed from the exact tempo since the last tempo change instead of
+// adding up a rounded number of samples per pulse, so the average tempo is exact
+// however long the sequencer runs.
+func pulseFrames(n int64) int64 {
+	return anchorFrame + ((n-anchorPulse)*60000*int64(sampleRate))/(clocksPerBeat*millitempo())
+}
+
+// setTempo validates a tempo and changes to it at the start of the next period.
+// It must only be called from the process callback.
+func setTempo(bpm float64) error {
+	if err := validateTempo(bpm); err != nil {
+		return err
+	}
+	tempoNext = bpm
+	return nil
+}
+
+// tempoControl handles a CC received on the NordDrumRecv port,
+// which sets the tempo from minTempo (0) to maxTempo (127) if it is tempoCC.
+func tempoControl(in []byte) {
+	if len(in) < 3 || in[0]&0xF0 != 0xB0 || int(in[1]) != tempoCC {
+		return
+	}
+	tempoNext = minTempo + (float64(in[2])*(maxTempo-minTempo))/127
+}
+
+// tempoPad handles a pad press in the first row while a top-row button is held at a frame time.
+// The pads on the left slow down and the pads on the right speed up:
+// the outer ones by 10 BPM, then tempoCoarse, then tempoFine.
+// The two pads in the middle tap the tempo.
+func tempoPad(x int, at uint64) {
+	switch x {
+	case 3, 4:
+		tap(at)
+	case 0:
+		changeTempo(-10 * tempoCoarse)
+	case 1:
+		changeTempo(-tempoCoarse)
+	case 2:
+		changeTempo(-tempoFine)
+	case 5:
+		changeTempo(tempoFine)
+	case 6:
+		changeTempo(tempoCoarse)
+	case 7:
+		changeTempo(10 * tempoCoarse)
+	}
+}
+
+// validateTempo checks that a tempo is between minTempo and maxTempo.
+func validateTempo(bpm float64) error {
+	if bpm < minTempo || bpm > maxTempo {
+		return errors.Errorf("tempo must be between %d and %d BPM", minTempo, maxTempo)
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// LEDColor is a green and red brightness, from 0 (off) to 3 (full).
+// RGB Launchpads show it as the nearest RGB color (see lightLED).
+type LEDColor struct {
+	G, R int
+}
+
+// Theme is the colors the grid shows steps in.
+type Theme struct {
+	Tracks   [8]LEDColor // Color of each track's steps that are on.
+	Accent   LEDColor    // Color of the steps that are on in accented columns, in the steps view.
+	Playhead LEDColor    // Color of the steps that are off under the chase light.
+}
+
+// ledColors are the colors that track configs can name.
+var ledColors = map[string]LEDColor{
+	"green":      {3, 0},
+	"lime":       {3, 1},
+	"yellow":     {3, 2},
+	"amber":      {3, 3},
+	"orange":     {2, 3},
+	"red":        {0, 3},
+	"dim-green":  {1, 0},
+	"dim-yellow": {2, 1},
+	"dim-amber":  {1, 1},
+	"dim-red":    {0, 1},
+}
+
+// themes are the built-in themes.
+var themes = map[string]Theme{
+	"classic": {
+		Tracks:   [8]LEDColor{{3, 0}, {3, 0}, {3, 0}, {3, 0}, {3, 0}, {3, 0}, {3, 0}, {3, 0}},
+		Accent:   LEDColor{3, 3},
+		Playhead: LEDColor{1, 1},
+	},
+	"rainbow": {
+		Tracks:   [8]LEDColor{{3, 0}, {3, 1}, {3, 2}, {2, 3}, {0, 3}, {1, 0}, {2, 1}, {0, 1}},
+		Accent:   LEDColor{3, 3},
+		Playhead: LEDColor{1, 1},
+	},
+	"pairs": {
+		Tracks:   [8]LEDColor{{3, 0}, {3, 0}, {3, 2}, {3, 2}, {2, 3}, {2, 3}, {0, 3}, {0, 3}},
+		Accent:   LEDColor{3, 3},
+		Playhead: LEDColor{1, 0},
+	},
+}
+
+var (
+	themeName = "classic"         // Name of the theme the grid is shown in.
+	theme     = themes[themeName] // Theme the grid is shown in.
+)
+
+// themeNames returns the names of the themes in alphabetical order.
+func themeNames() []string {
+	names := make([]string, 0, len(themes))
+	for name := range themes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// colorNames returns the names of the colors in alphabetical order.
+func colorNames() []string {
+	names := make([]string, 0, len(ledColors))
+	for name := range ledColors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// setTheme selects a built-in theme by name.
+func setTheme(name string) error {
+	t, ok := themes[name]
+	if !ok {
+		return errors.Errorf("unknown theme %q (want one of %s)", name, strings.Join(themeNames(), ", "))
+	}
+	theme = t
+	return nil
+}
+
+// validateColor checks that a track config's color is empty or a color name.
+func validateColor(name string) error {
+	if _, ok := ledColors[name]; name != "" && !ok {
+		return errors.Errorf("unknown color %q (want one of %s)", name, strings.Join(colorNames(), ", "))
+	}
+	return nil
+}
+
+// trackColor returns the color of a track's steps that are on:
+// the color of its track config, or else the theme's.
+func trackColor(track int) (g, r int) {
+	c, ok := ledColors[trackConfigs[track].Color]
+	if !ok {
+		c = theme.Tracks[track]
+	}
+	return c.G, c.R
+}
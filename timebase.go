@@ -0,0 +1,54 @@
+package main
+
+import (
+	"github.com/pkg/errors"
+)
+
+const (
+	ticksPerBeat  = 1920                         // Ticks in a beat of the published position.
+	ticksPerPulse = ticksPerBeat / clocksPerBeat // Ticks in a MIDI clock pulse.
+)
+
+var timebase bool // Flag telling us if ndseq is the transport's timebase master.
+
+// validateTimebase checks that the position published as timebase master comes from the internal clock.
+func validateTimebase() error {
+	if timebase && syncMode != syncInternal {
+		return errors.New("timebase needs the internal clock: ndseq only publishes the position of its own tempo")
+	}
+	return nil
+}
+
+// publishPosition publishes the bar, beat and tick of the internal clock at the start of the next period
+// when ndseq is timebase master. The beats are counted from the first step played, in bars of beatsPerBar beats.
+func publishPosition() {
+	if !timebase {
+		return
+	}
+	var ticks int64
+	if firstNotePlayed {
+		var (
+			frame      = int64(frameCount)
+			n          = pulseAt(frame)
+			start, end = pulseFrames(n), pulseFrames(n + 1)
+		)
+		ticks = n * ticksPerPulse
+		if end > start {
+			ticks += ((frame - start) * ticksPerPulse) / (end - start)
+		}
+	}
+	var (
+		beats = ticks / ticksPerBeat
+		bars  = beats / beatsPerBar
+	)
+	backend.Publish(Position{
+		Bar:            int(bars) + 1,
+		Beat:           int(beats%beatsPerBar) + 1,
+		Tick:           int(ticks % ticksPerBeat),
+		BarStartTick:   float64(bars * beatsPerBar * ticksPerBeat),
+		BeatsPerBar:    beatsPerBar,
+		BeatType:       4,
+		TicksPerBeat:   ticksPerBeat,
+		BeatsPerMinute: tempo,
+	})
+}
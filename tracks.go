@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// TrackConfig says how a track's trigs are sent to the drum module.
+type TrackConfig struct {
+	Channel  int      `json:"channel"`                                            // MIDI channel, from 1 to 16. Zero, in built-in kits only, plays nothing.
+	Note     uint8    `json:"note"`                                               // Note played by steps that do not have their own.
+	Velocity int      `json:"velocity,omitempty"`                                 // Percentage the velocity of trigs is scaled by. Zero means 100.
+	Humanize Humanize `json:"humanize"`                                           // Random deviations of the track's hits.
+	Layers   []Layer  `json:"layers,omitempty"`                                   // Other channels and notes the track's hits are also sent to.
+	Label    string   `json:"label,omitempty"`                                    // Name of the track's sound, for humans.
+	Color    string   `json:"color,omitempty"`                                    // Name of the color the track's steps are lit in. Empty means the theme's.
+	RTPMIDI  bool     `json:"rtpmidi,omitempty"`                                  // Flag telling us if the track is also played on the RTP-MIDI peers.
+	UMP      bool     `json:"ump,omitempty"`                                      // Flag telling us if the track is sent as MIDI 2.0 packets with --ump.
+	FineCCs  []CC     `json:"fine_ccs,omitempty" yaml:"fine_ccs" toml:"fine_ccs"` // CCs from 0 to 31 the track's device takes with 14 bits, the LSB on the CC fineOffset above.
+}
+
+const fineOffset = 32 // Distance from a CC sent with 14 bits to the CC of its low 7 bits.
+
+// fine reports whether the track sends a CC with 14 bits, as an MSB and LSB pair.
+func (c TrackConfig) fine(cc CC) bool {
+	for _, f := range c.FineCCs {
+		if f == cc {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	trackPath    string         // File the track configs are read from. Empty keeps the defaults.
+	baseChannel  int            // MIDI channel of the first track when no track config file is given.
+	trackConfigs [8]TrackConfig // Output config of each track.
+)
+
+// assigned reports whether a track has a channel. The built-in kits of instruments with fewer channels
+// than tracks leave the other tracks without one.
+func (c TrackConfig) assigned() bool {
+	return c.Channel > 0
+}
+
+// channel returns the zero-based MIDI channel of a track's messages.
+func (c TrackConfig) channel() byte {
+	return byte(c.Channel-1) & 0x0F
+}
+
+// scale scales a velocity by the track's velocity percentage, limited to 1-127.
+func (c TrackConfig) scale(velocity uint8) uint8 {
+	if c.Velocity == 0 {
+		return velocity
+	}
+	v := (int(velocity) * c.Velocity) / 100
+	if v < 1 {
+		return 1
+	}
+	if v > 127 {
+		return 127
+	}
+	return uint8(v)
+}
+
+// validate checks that a track config has a valid channel, note, velocity, layers and humanize settings.
+func (c TrackConfig) validate() error {
+	if c.Channel < 1 || c.Channel > 16 {
+		return errors.New("channel must be between 1 and 16")
+	}
+	if c.Note > 127 {
+		return errors.New("note must be between 0 and 127")
+	}
+	if c.Velocity < 0 {
+		return errors.New("velocity must not be negative")
+	}
+	for _, l := range c.Layers {
+		if err := l.validate(); err != nil {
+			return err
+		}
+	}
+	if err := validateColor(c.Color); err != nil {
+		return err
+	}
+	for _, cc := range c.FineCCs {
+		if cc >= fineOffset {
+			return errors.Errorf("fine CC %d must be between 0 and %d", cc, fineOffset-1)
+		}
+	}
+	return c.Humanize.validate()
+}
+
+// loadTracks sets up the track configs.
+// Without a config file the tracks play ndNote on consecutive channels from baseChannel,
+// which is how the Nord Drum 3p is set up out of the box.
+func loadTracks(path string) error {
+	if path == "" {
+		if baseChannel < 1 || baseChannel+len(trackConfigs)-1 > 16 {
+			return errors.Errorf("channel must be between 1 and %d", 17-len(trackConfigs))
+		}
+		for i := range trackConfigs {
+			trackConfigs[i] = TrackConfig{Channel: baseChannel + i, Note: ndNote}
+		}
+		return nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return errors.Wrap(err, "opening track config file")
+	}
+	defer func() { _ = f.Close() }() // Best effort.
+
+	var configs []TrackConfig
+	if err := json.NewDecoder(f).Decode(&configs); err != nil {
+		return errors.Wrap(err, "decoding track config file")
+	}
+	if len(configs) != len(trackConfigs) {
+		return errors.Errorf("track config file must have %d tracks", len(trackConfigs))
+	}
+	for i, c := range configs {
+		if err := c.validate(); err != nil {
+			return errors.Wrapf(err, "track %d", i)
+		}
+		trackConfigs[i] = c
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package main
+
+// moveSteps moves every step of a track to a new position in a pattern of length steps.
+// to returns the new position of a step, and must map the steps one to one.
+// Everything stored per step of the track moves with it, including parameter locks.
+// Accents belong to every track, so they move with moveAccents when every track moves.
+func (p *Pattern) moveSteps(track, length int, to func(step int) int) {
+	var (
+		trigs       = p.Trigs[track]
+		fill        = p.Fill[track]
+		minVelocity = p.MinVelocity[track]
+		probability = p.Probability[track]
+		conditions  = p.Conditions[track]
+		ratchets    = p.Ratchets[track]
+		microTiming = p.MicroTiming[track]
+		gates       = p.Gates[track]
+		notes       = p.Notes[track]
+		chords      = p.Chords[track]
+		pitch       = p.Pitch[track]
+	)
+	for step := 0; step < length; step++ {
+		dst := to(step)
+		p.Trigs[track][dst] = trigs[step]
+		p.Fill[track][dst] = fill[step]
+		p.MinVelocity[track][dst] = minVelocity[step]
+		p.Probability[track][dst] = probability[step]
+		p.Conditions[track][dst] = conditions[step]
+		p.Ratchets[track][dst] = ratchets[step]
+		p.MicroTiming[track][dst] = microTiming[step]
+		p.Gates[track][dst] = gates[step]
+		p.Notes[track][dst] = notes[step]
+		p.Chords[track][dst] = chords[step]
+		p.Pitch[track][dst] = pitch[step]
+	}
+	for i, l := range p.Locks {
+		if l.Track == track && l.Step < length {
+			p.Locks[i].Step = to(l.Step)
+		}
+	}
+}
+
+// moveAccents moves the accents of a pattern of length steps like moveSteps moves a track's steps.
+func (p *Pattern) moveAccents(length int, to func(step int) int) {
+	accents := p.Accents
+	for step := 0; step < length; step++ {
+		p.Accents[to(step)] = accents[step]
+	}
+}
+
+// invert turns the trigs of a track of a pattern of length steps off and the steps without one on.
+func (p *Pattern) invert(track, length int) {
+	for step := 0; step < length; step++ {
+		if p.Trigs[track][step] > 0 {
+			p.Trigs[track][step] = 0
+		} else {
+			p.Trigs[track][step] = defaultVelocity
+		}
+	}
+}
+
+// mirror reverses a track of a pattern of length steps in time.
+func (p *Pattern) mirror(track, length int) {
+	p.moveSteps(track, length, mirrored(length))
+}
+
+// mirrorAll reverses every track of a pattern of length steps in time, with the accents.
+func (p *Pattern) mirrorAll(length int) {
+	for track := range p.Trigs {
+		p.mirror(track, length)
+	}
+	p.moveAccents(length, mirrored(length))
+}
+
+// rotate rotates a track of a pattern of length steps by n steps, to the right if n is positive.
+// Steps that fall off one end come back in at the other.
+func (p *Pattern) rotate(track, length, n int) {
+	p.moveSteps(track, length, rotated(length, n))
+}
+
+// rotateAll rotates every track of a pattern of length steps by n steps, with the accents.
+func (p *Pattern) rotateAll(length, n int) {
+	for track := range p.Trigs {
+		p.rotate(track, length, n)
+	}
+	p.moveAccents(length, rotated(length, n))
+}
+
+// mirrored returns the new position of each step of a pattern of length steps reversed in time.
+func mirrored(length int) func(step int) int {
+	return func(step int) int { return length - 1 - step }
+}
+
+// rotated returns the new position of each step of a pattern of length steps rotated by n steps.
+func rotated(length, n int) func(step int) int {
+	n %= length
+	if n < 0 {
+		n += length
+	}
+	return func(step int) int { return (step + n) % length }
+}
+
+// transformPad handles a pad press in the seventh row while a side button is held.
+// The first two pads invert and mirror the held track, and the last two invert and mirror every track.
+func transformPad(track, x int) {
+	switch x {
+	case 0:
+		bank[slot].invert(track, steps)
+	case 1:
+		bank[slot].mirror(track, steps)
+	case gridSize - 2:
+		for t := range trigs {
+			bank[slot].invert(t, steps)
+		}
+	case gridSize - 1:
+		bank[slot].mirrorAll(steps)
+	default:
+		return
+	}
+	gridPainted = false
+}
+
+// rotatePad handles a pad press in the sixth row while a side button is held.
+// The first two pads rotate the held track left and right by a step,
+// and the last two rotate every track.
+func rotatePad(track, x int) {
+	switch x {
+	case 0:
+		bank[slot].rotate(track, steps, -1)
+	case 1:
+		bank[slot].rotate(track, steps, 1)
+	case gridSize - 2:
+		bank[slot].rotateAll(steps, -1)
+	case gridSize - 1:
+		bank[slot].rotateAll(steps, 1)
+	default:
+		return
+	}
+	gridPainted = false
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"testing"
+)
+
+// stepPattern returns a pattern whose per-step lanes of a track hold a value derived from each step,
+// so that tests can tell where each step went.
+func stepPattern(track, length int) *Pattern {
+	p := &Pattern{}
+	for step := 0; step < length; step++ {
+		v := uint8(step + 1)
+		p.Trigs[track][step] = v
+		p.Fill[track][step] = v + 1
+		p.MinVelocity[track][step] = v + 2
+		p.Probability[track][step] = v + 3
+		p.Conditions[track][step] = Condition(v % 4)
+		p.Ratchets[track][step] = v + 4
+		p.MicroTiming[track][step] = int8(step - 6)
+		p.Gates[track][step] = v + 5
+		p.Notes[track][step] = v + 6
+		p.Chords[track][step] = v + 7
+		p.Pitch[track][step] = int8(step - 3)
+		p.Accents[step] = step%3 == 0
+	}
+	p.Locks = []Lock{{Track: track, Step: 1, CC: 7, Value: 64}, {Track: track + 1, Step: 1, CC: 7, Value: 32}}
+	return p
+}
+
+func TestMoveSteps(t *testing.T) {
+	const (
+		track  = 2
+		length = 12
+	)
+	for _, tc := range []struct {
+		name      string
+		transform func(p *Pattern)
+		to        func(step int) int
+	}{
+		{"mirror", func(p *Pattern) { p.mirror(track, length) }, mirrored(length)},
+		{"rotate right", func(p *Pattern) { p.rotate(track, length, 1) }, rotated(length, 1)},
+		{"rotate left", func(p *Pattern) { p.rotate(track, length, -3) }, func(step int) int { return (step + length - 3) % length }},
+		{"rotate past the length", func(p *Pattern) { p.rotate(track, length, length+2) }, func(step int) int { return (step + 2) % length }},
+	} {
+		var (
+			src = stepPattern(track, length)
+			dst = stepPattern(track, length)
+		)
+		tc.transform(dst)
+
+		for step := 0; step < length; step++ {
+			to := tc.to(step)
+			for _, lane := range []struct {
+				name     string
+				src, dst int
+			}{
+				{"trigs", int(src.Trigs[track][step]), int(dst.Trigs[track][to])},
+				{"fill", int(src.Fill[track][step]), int(dst.Fill[track][to])},
+				{"min velocity", int(src.MinVelocity[track][step]), int(dst.MinVelocity[track][to])},
+				{"probability", int(src.Probability[track][step]), int(dst.Probability[track][to])},
+				{"conditions", int(src.Conditions[track][step]), int(dst.Conditions[track][to])},
+				{"ratchets", int(src.Ratchets[track][step]), int(dst.Ratchets[track][to])},
+				{"micro timing", int(src.MicroTiming[track][step]), int(dst.MicroTiming[track][to])},
+				{"gates", int(src.Gates[track][step]), int(dst.Gates[track][to])},
+				{"notes", int(src.Notes[track][step]), int(dst.Notes[track][to])},
+				{"chords", int(src.Chords[track][step]), int(dst.Chords[track][to])},
+				{"pitch", int(src.Pitch[track][step]), int(dst.Pitch[track][to])},
+			} {
+				if lane.src != lane.dst {
+					t.Errorf("%s: %s of step %d is %d on step %d, want %d", tc.name, lane.name, step, lane.dst, to, lane.src)
+				}
+			}
+		}
+		if dst.Accents != src.Accents {
+			t.Errorf("%s: moving one track moved the accents every track shares", tc.name)
+		}
+		if got, want := dst.Locks[0].Step, tc.to(1); got != want {
+			t.Errorf("%s: lock moved to step %d, want %d", tc.name, got, want)
+		}
+		if dst.Locks[1].Step != 1 {
+			t.Errorf("%s: lock of another track moved to step %d", tc.name, dst.Locks[1].Step)
+		}
+		for step := length; step < maxSteps; step++ {
+			if dst.Trigs[track][step] != 0 {
+				t.Errorf("%s: step %d past the length got trig %d", tc.name, step, dst.Trigs[track][step])
+			}
+		}
+	}
+}
+
+func TestMoveAccents(t *testing.T) {
+	const length = 12
+
+	for _, tc := range []struct {
+		name      string
+		transform func(p *Pattern)
+		to        func(step int) int
+	}{
+		{"mirror all", func(p *Pattern) { p.mirrorAll(length) }, mirrored(length)},
+		{"rotate all", func(p *Pattern) { p.rotateAll(length, 5) }, rotated(length, 5)},
+	} {
+		var (
+			src = stepPattern(0, length)
+			dst = stepPattern(0, length)
+		)
+		tc.transform(dst)
+
+		for step := 0; step < length; step++ {
+			if to := tc.to(step); dst.Accents[to] != src.Accents[step] {
+				t.Errorf("%s: accent of step %d is %t on step %d", tc.name, step, dst.Accents[to], to)
+			}
+			if to := tc.to(step); dst.Trigs[0][to] != src.Trigs[0][step] {
+				t.Errorf("%s: trig of step %d is %d on step %d", tc.name, step, dst.Trigs[0][to], to)
+			}
+		}
+	}
+}
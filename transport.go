@@ -0,0 +1,75 @@
+package main
+
+const (
+	syncTransport = "transport" // Follow the JACK transport.
+)
+
+var (
+	transportRolling bool  // Flag telling us if the JACK transport was rolling in the last period.
+	transportNext    int64 // Transport frame the next period starts at if the transport isn't relocated.
+)
+
+// followTransport advances the sequencer from the JACK transport.
+// The playhead is derived from the transport frame, so relocating the transport
+// relocates the playhead. Stopping the transport resets the playhead to the first step,
+// where the chase light flashes until it rolls again.
+// Like tick, it triggers every step that starts before the end of the period plus the lookahead,
+// delayed and lengthened by swing and groove, and wrapping around the loop.
+func followTransport(nframes uint32, ledBuffer MidiBuffer) int {
+	rolling, frame := backend.Transport()
+
+	if !rolling {
+		if transportRolling {
+			transportRolling = false
+			beat, firstNotePlayed = 0, false
+			resetPlayheads()
+
+			if clockOut && clockRunning {
+				clockRunning = false
+				queue(-1, 0, midiStop)
+			}
+			return cueChase(ledBuffer)
+		}
+		return 0
+	}
+	transportRolling = true
+	applyTempo(frame)
+
+	if samplesPerBeat == 0 {
+		return 0
+	}
+	horizon := frame + int64(nframes) + int64(lookaheadFrames())
+	if !firstNotePlayed || frame != transportNext {
+		locateTransport(frame)
+	}
+	transportNext = frame + int64(nframes)
+
+	for {
+		at := stepFrames(stepCount) + stepDelay(beat)
+		if at >= horizon {
+			break
+		}
+		if at < frame {
+			at = frame
+		}
+		stepLen = stepLength(beat)
+		code := trigger(uint32(at-frame), nframes, ledBuffer)
+		firstNotePlayed = true
+		if isFailure(code) {
+			return code
+		}
+		stepCount++
+	}
+	clock(nframes, frame)
+	runRepeats(nframes, frame)
+	return 0
+}
+
+// locateTransport moves the playhead to the first step that starts at or after a transport frame,
+// when the transport starts rolling or is relocated.
+// The steps are counted from the start of the transport and wrap around the loop.
+func locateTransport(frame int64) {
+	stepCount = stepIndexAt(frame)
+	beat = loopFirst() + int(stepCount%int64(loopLength()))
+	locatePlayheads(uint64(stepCount))
+}
@@ -0,0 +1,169 @@
+package main
+
+import "encoding/binary"
+
+const umpPortType = "32 bit raw UMP" // JACK port type of Universal MIDI Packet ports, as PipeWire's JACK support names it.
+
+// MIDI 2.0 channel voice statuses, in the high nibble of a status byte like MIDI 1.0 ones.
+const (
+	umpPerNoteCC = 0x10 // Assignable per-note controller.
+	umpNoteOff   = 0x80
+	umpNoteOn    = 0x90
+	umpCC        = 0xB0
+)
+
+var (
+	umpOut    bool  // Flag telling us if the tracks with ump set in their track config are sent as MIDI 2.0 packets.
+	umpOutput *Port // JACK port for sending the UMP tracks, when umpOut is set.
+	umpBuffer MidiBuffer
+
+	// umpHeld holds the CCs of UMP tracks until a message at a later frame, or a message of their own track
+	// at the same frame that is not a CC, is written. Messages of other tracks at the same frame leave them held.
+	// CCs followed by a note on of their track and channel at the same frame, such as parameter locks,
+	// are sent as per-note controllers of the note.
+	umpHeld struct {
+		events [maxQueued]queuedEvent
+		n      int
+	}
+)
+
+// addUMPPort adds the UMPSend port when tracks are sent as MIDI 2.0 packets.
+// The port is not connected automatically; route it to a MIDI 2.0 device in the JACK graph.
+func addUMPPort() {
+	if umpOut {
+		Ports.Outputs["UMPSend"] = &Port{Matches: none, Type: umpPortType}
+	}
+}
+
+// setUMPOutput looks up the registered UMP port.
+func setUMPOutput() {
+	if umpOut {
+		umpOutput = Ports.Outputs["UMPSend"]
+	}
+}
+
+// clearUMPBuffer gets the buffer of the UMP port for the current period.
+func clearUMPBuffer(nframes uint32) {
+	if umpOut {
+		umpBuffer = backend.Buffer(umpOutput, nframes)
+	}
+}
+
+// isUMP reports whether a track's messages are sent as MIDI 2.0 packets.
+// The other tracks, and every track unless --ump is given, keep sending MIDI 1.0 messages, which is what the Nord Drum takes.
+func isUMP(track int) bool {
+	return umpOut && track >= 0 && track < len(trackConfigs) && trackConfigs[track].UMP
+}
+
+// writeUMP writes a message of a UMP track to the UMP port as a MIDI 2.0 packet.
+// CCs are held back to see if a note on of the same track and channel follows them at the same frame (see umpHeld).
+func writeUMP(e *queuedEvent) int {
+	var (
+		status = e.data[0] & 0xF0
+		cc     = e.size == 3 && status == umpCC
+		noteOn = e.size == 3 && status == umpNoteOn && e.data[2] > 0
+		n      = 0
+	)
+	for i := 0; i < umpHeld.n; i++ {
+		h := umpHeld.events[i]
+		var code int
+		switch {
+		case h.time == e.time && (h.track != e.track || cc):
+			umpHeld.events[n] = h
+			n++
+			continue
+		case h.time == e.time && noteOn && h.data[0] == umpCC|(e.data[0]&0x0F):
+			code = writePacket(e.time, umpPacket(umpPerNoteCC|(h.data[0]&0x0F), e.data[1], h.data[1], upscale(uint32(h.data[2]), 7, 32)))
+		default:
+			code = writeTranslated(&h)
+		}
+		if isFailure(code) {
+			return code
+		}
+	}
+	umpHeld.n = n
+
+	if cc && umpHeld.n < len(umpHeld.events) {
+		umpHeld.events[umpHeld.n] = *e
+		umpHeld.n++
+		return 0
+	}
+	return writeTranslated(e)
+}
+
+// flushUMP writes the CCs still held at the end of the period.
+func flushUMP() int {
+	defer func() { umpHeld.n = 0 }()
+
+	for i := 0; i < umpHeld.n; i++ {
+		if code := writeTranslated(&umpHeld.events[i]); isFailure(code) {
+			return code
+		}
+	}
+	return 0
+}
+
+// writeTranslated writes a MIDI 1.0 message as a MIDI 2.0 packet, as the MIDI 2.0 translation rules say:
+// velocities are scaled up to 16 bits and CC values to 32, so that full scale stays full scale.
+// Other messages are sent as MIDI 1.0 channel voice packets.
+func writeTranslated(e *queuedEvent) int {
+	var (
+		status  = e.data[0]
+		channel = status & 0x0F
+	)
+	switch {
+	case e.size == 3 && (status&0xF0 == umpNoteOff || (status&0xF0 == umpNoteOn && e.data[2] == 0)):
+		return writePacket(e.time, umpPacket(umpNoteOff|channel, e.data[1], 0, upscale(64, 7, 16)<<16))
+	case e.size == 3 && status&0xF0 == umpNoteOn:
+		return writePacket(e.time, umpPacket(umpNoteOn|channel, e.data[1], 0, upscale(uint32(e.data[2]), 7, 16)<<16))
+	case e.size == 3 && status&0xF0 == umpCC:
+		return writePacket(e.time, umpPacket(umpCC|channel, e.data[1], 0, upscale(uint32(e.data[2]), 7, 32)))
+	}
+	var word [3]byte
+	copy(word[:], e.data[:e.size])
+	return writeWords(e.time, (0x2<<28)|(uint32(word[0])<<16)|(uint32(word[1])<<8)|uint32(word[2]))
+}
+
+// umpPacket returns the two words of a MIDI 2.0 channel voice packet in group 1.
+func umpPacket(status, index1, index2 byte, data uint32) [2]uint32 {
+	return [2]uint32{(0x4 << 28) | (uint32(status) << 16) | (uint32(index1) << 8) | uint32(index2), data}
+}
+
+// writePacket writes a MIDI 2.0 channel voice packet to the UMP port.
+func writePacket(time uint32, p [2]uint32) int {
+	return writeWords(time, p[:]...)
+}
+
+// writeWords writes the words of a packet to the UMP port, in the little-endian order of the hosts JACK runs on.
+func writeWords(time uint32, words ...uint32) int {
+	var buf [8]byte
+	for i, w := range words {
+		binary.LittleEndian.PutUint32(buf[i*4:], w)
+	}
+	return backend.Write(umpOutput, &MidiEvent{Time: time, Buffer: buf[:len(words)*4]}, umpBuffer)
+}
+
+// upscale scales a value up from srcBits to dstBits with the MIDI 2.0 min-center-max method:
+// zero, the center and the maximum of the source map to zero, the center and the maximum of the destination.
+func upscale(v uint32, srcBits, dstBits uint) uint32 {
+	var (
+		scaleBits  = dstBits - srcBits
+		shifted    = v << scaleBits
+		center     = uint32(1) << (srcBits - 1)
+		repeatBits = srcBits - 1
+	)
+	if v <= center {
+		return shifted
+	}
+	repeat := v & ((1 << repeatBits) - 1)
+	if scaleBits > repeatBits {
+		repeat <<= scaleBits - repeatBits
+	} else {
+		repeat >>= repeatBits - scaleBits
+	}
+	for repeat != 0 {
+		shifted |= repeat
+		repeat >>= repeatBits
+	}
+	return shifted
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"github.com/pkg/errors"
+)
+
+// stepVelocity returns the velocity a trig plays at.
+// Steps with a minimum velocity draw it at random from the minimum up to the trig's velocity.
+func stepVelocity(track, step int, trig uint8) uint8 {
+	lo, hi := bank[slot].MinVelocity[track][step], trig
+	if lo == 0 || lo == hi {
+		return trig
+	}
+	if lo > hi {
+		lo, hi = hi, lo
+	}
+	return lo + uint8(rand()%uint32(hi-lo+1))
+}
+
+// validateVelocities checks the minimum velocities of the patterns in a bank.
+func validateVelocities(b *[numSlots]Pattern) error {
+	for i := range b {
+		for track := range b[i].MinVelocity {
+			for step, v := range b[i].MinVelocity[track] {
+				if v > 127 {
+					return errors.Errorf("slot %d track %d step %d: minimum velocity must be from 0 to 127", i, track, step)
+				}
+			}
+		}
+	}
+	return nil
+}
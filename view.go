@@ -0,0 +1,208 @@
+package main
+
+// Views select what the grid pads edit and display.
+// A view is chosen by holding any side button and pressing a top-row button.
+const (
+	viewSteps       = iota // Pads toggle trigs.
+	viewProbability        // Pads cycle the probability of trigs.
+	viewCondition          // Pads cycle the condition of trigs.
+	viewRatchet            // Pads cycle the number of hits of trigs.
+	viewMicroTiming        // Pads cycle the micro-timing offset of trigs.
+	viewNotes              // Pads set the notes of the focus track's trigs.
+	viewChords             // Pads add notes to or remove notes from the chords of the focus track's trigs.
+	viewFill               // Pads toggle the trigs of the fill lanes.
+	numViews
+)
+
+const (
+	sideColumn = 8 // Column of the Launchpad side buttons in the grid.
+)
+
+var (
+	view int // Current view.
+
+	sideHeld  [gridSize]bool // Flags telling us which side buttons are held down.
+	sideUsed  bool           // Flag telling us if a held side button was used as a modifier.
+	sidePress int            // Number of side buttons held down.
+)
+
+// editStep handles a pad press on a step according to the current view.
+// In the note and chord views the pad's row picks a note instead of a track.
+// Steps turned on in the steps view get the velocity the pad was struck with.
+func editStep(track, step int, velocity uint8, ledBuffer MidiBuffer) int {
+	switch view {
+	case viewNotes:
+		return setNote(step, track, ledBuffer)
+	case viewChords:
+		return toggleChordNote(step, track, ledBuffer)
+	case viewSteps:
+		if trigs[track][step] == 0 {
+			trigs[track][step] = velocity
+		} else {
+			trigs[track][step] = 0
+		}
+	case viewProbability:
+		cycleProbability(track, step)
+	case viewCondition:
+		cycleCondition(track, step)
+	case viewRatchet:
+		cycleRatchets(track, step)
+	case viewMicroTiming:
+		cycleMicroTiming(track, step)
+	case viewFill:
+		toggleFill(track, step)
+	}
+	return lightStep(track, step, ledBuffer)
+}
+
+// holdStep handles the pressure on a held pad in the steps view, with --aftertouch on a velocity-sensitive controller:
+// pressing harder on a step that is on raises its velocity to the pressure.
+func holdStep(x, y int, pressure uint8, ledBuffer MidiBuffer) int {
+	if view != viewSteps || editing() {
+		return 0
+	}
+	track, step, ok := padStep(x, y)
+	if !ok || trigs[track][step] == 0 || pressure <= trigs[track][step] {
+		return 0
+	}
+	trigs[track][step] = pressure
+	return lightStep(track, step, ledBuffer)
+}
+
+// heldTrack returns the track of the first held side button, or -1 if none is held.
+func heldTrack() int {
+	for y, held := range sideHeld {
+		if held {
+			return y
+		}
+	}
+	return -1
+}
+
+// selectView switches the grid to a view, leaving any parameter page, and repaints it on the next cycle.
+func selectView(v int) {
+	if v < 0 || v >= numViews {
+		return
+	}
+	view, editPage = v, -1
+	gridPainted = false
+}
+
+// shifted reports if a side button is held down, and marks it as used as a modifier.
+func shifted() bool {
+	if sidePress == 0 {
+		return false
+	}
+	sideUsed = true
+	return true
+}
+
+// side handles presses and releases of the Launchpad side buttons.
+// Side buttons act when they are released, so that they can also be held as modifiers:
+// releasing a button that was not used as a modifier mutes or unmutes its track
+// (or shows it in the note and chord views and on parameter pages),
+// and releasing one while another is held solos or unsolos its track.
+// Pressing one while a top-row button is held sends a MIDI panic.
+func side(y int, pressed bool, ledBuffer MidiBuffer) int {
+	if y < 0 || y >= gridSize || sideHeld[y] == pressed {
+		return 0
+	}
+	sideHeld[y] = pressed
+
+	if pressed {
+		sidePress++
+		if heldSlot() >= 0 {
+			topUsed, sideUsed = true, true
+			midiPanic()
+		}
+		return 0
+	}
+	sidePress--
+
+	if sidePress > 0 {
+		sideUsed = true
+		return toggleSolo(y, ledBuffer)
+	}
+	if sideUsed {
+		sideUsed = false
+		return 0
+	}
+	if pianoRoll() || editing() {
+		selectFocus(y)
+		return 0
+	}
+	return toggleMute(y, ledBuffer)
+}
+
+// trackAction handles a pad press while a side button is held.
+// The pad at column x and row y picks a setting or an action for the held button's track:
+// row 0 picks its direction and row 1 its speed. Rows 2 and 3 randomize the track with
+// a density of (x+1)/8, with fixed and random velocities respectively.
+func trackAction(track, x, y int) {
+	sideUsed = true
+
+	switch y {
+	case 0:
+		if x < int(numDirections) {
+			bank[slot].Direction[track] = Direction(x)
+		}
+	case 1:
+		if x == gridSize-1 {
+			toggleTriplet(track)
+		} else if s := Speed(x) + speedQuarter; s <= speedQuadruple {
+			bank[slot].Speed[track] = s
+		}
+	case 2, 3:
+		randomizeTrack(track, ((x+1)*100)/gridSize, y == 3)
+	case 4:
+		setGate(track, ((x+1)*100)/gridSize)
+	case 5:
+		rotatePad(track, x)
+	case 6:
+		transformPad(track, x)
+	case 7:
+		toggleAccent(x)
+	}
+}
+
+// stepColor returns the green and red brightness of a step's LED in the current view.
+func stepColor(track, step int) (g, r int) {
+	if view == viewFill {
+		if bank[slot].Fill[track][step] == 0 {
+			return 0, 0
+		}
+		return 2, 3
+	}
+	if trigs[track][step] == 0 {
+		return 0, 0
+	}
+	switch view {
+	case viewCondition:
+		return bank[slot].Conditions[track][step].color()
+	case viewMicroTiming:
+		return microTimingColor(track, step)
+	case viewRatchet:
+		switch ratchetCount(track, step) {
+		case 2:
+			return 3, 2
+		case 3:
+			return 2, 3
+		case 4:
+			return 0, 3
+		}
+	case viewProbability:
+		switch probability(track, step) {
+		case 75:
+			return 3, 2
+		case 50:
+			return 2, 3
+		case 25:
+			return 0, 3
+		}
+	case viewSteps:
+		if bank[slot].Accents[step] {
+			return theme.Accent.G, theme.Accent.R
+		}
+	}
+	return trackColor(track)
+}
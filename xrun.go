@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const xrunInterval = time.Minute // Period xruns are reported for.
+
+var (
+	xruns         uint64 // Number of xruns since ndseq started or the count was reset. Accessed atomically.
+	xrunThreshold int    // Number of xruns in xrunInterval above which a warning is logged. Zero disables the warning.
+)
+
+// xrun is the JACK xrun callback. It only counts the xrun: watchXruns reports them.
+func xrun() int {
+	atomic.AddUint64(&xruns, 1)
+	return 0
+}
+
+// watchXruns logs the number of xruns of every xrunInterval that had some,
+// with a warning when there were more than xrunThreshold.
+func watchXruns() {
+	var last uint64
+
+	for range time.Tick(xrunInterval) {
+		n := atomic.LoadUint64(&xruns)
+		if n < last {
+			last = 0 // The count was reset.
+		}
+		d := n - last
+		last = n
+
+		switch {
+		case d == 0:
+		case xrunThreshold > 0 && d > uint64(xrunThreshold):
+			fmt.Fprintf(os.Stderr, "warning: %d xruns in the last %s (%d in total), more than %d: try a larger buffer size\n", d, xrunInterval, n, xrunThreshold)
+		default:
+			fmt.Fprintf(os.Stderr, "%d xruns in the last %s (%d in total)\n", d, xrunInterval, n)
+		}
+	}
+}
+
+// xrunCount returns the number of xruns counted.
+func xrunCount() int {
+	return int(atomic.LoadUint64(&xruns))
+}
+
+// resetXruns resets the xrun count. It can only be set to zero.
+func resetXruns(n int) error {
+	if n != 0 {
+		return errors.New("xruns can only be reset to 0")
+	}
+	atomic.StoreUint64(&xruns, 0)
+	return nil
+}
+
+// validateXrunThreshold checks the xrun warning threshold.
+func validateXrunThreshold() error {
+	if xrunThreshold < 0 {
+		return errors.Errorf("xrun threshold must not be negative, got %d", xrunThreshold)
+	}
+	return nil
+}